@@ -0,0 +1,231 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package campaign notices bursts of near-identical messages, such as
+// a spam run from a compromised account, without a list of known spam.
+//
+// A CampaignDetector keeps the SpamSums of the messages seen during a
+// sliding time window.  Every arrival joins the group of the most
+// similar message still in the window, if it scores at least the
+// threshold against it, or starts a group of its own.  When a group
+// reaches the configured size within the window, the detector reports
+// it.
+package campaign
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+// A Clock tells the current time.  Tests use a Clock they control.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Config sets the behaviour of a CampaignDetector.
+type Config struct {
+	// Window is how long a message counts towards its group.
+	Window time.Duration
+	// Threshold is the score a message needs against a message in
+	// a group to join it.
+	Threshold uint32
+	// Size is the number of messages a group needs within Window to
+	// be reported.
+	Size int
+	// Params are the parameters of the SpamSums; zero means
+	// spamsum.DefaultParams.
+	Params spamsum.Params
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// An Event reports a group that reached the configured size.
+type Event struct {
+	// Group identifies the group; it stays the same for as long as
+	// the group has messages in the window.
+	Group uint64
+	// IDs are those of the messages in the group, oldest first.
+	IDs []string
+	// First and Last are the times of the oldest and newest message
+	// in the group.
+	First, Last time.Time
+	// Sum is the SpamSum of the first message in the group.
+	Sum *spamsum.SpamSum
+}
+
+// arrival is a message in the window.
+type arrival struct {
+	key   uint64
+	id    string
+	at    time.Time
+	group *group
+}
+
+// group is a set of similar arrivals.
+type group struct {
+	id       uint64
+	sum      *spamsum.SpamSum
+	members  map[uint64]*arrival
+	reported bool
+}
+
+// arrivals is a min-heap of arrivals by time, so that expiring the
+// oldest ones does not need a scan of the window.
+type arrivals []*arrival
+
+func (a arrivals) Len() int            { return len(a) }
+func (a arrivals) Less(i, j int) bool  { return a[i].at.Before(a[j].at) }
+func (a arrivals) Swap(i, j int)       { a[i], a[j] = a[j], a[i] }
+func (a *arrivals) Push(x interface{}) { *a = append(*a, x.(*arrival)) }
+func (a *arrivals) Pop() interface{} {
+	old := *a
+	last := old[len(old)-1]
+	*a = old[:len(old)-1]
+	return last
+}
+
+// A CampaignDetector finds groups of similar messages in a stream.  It
+// is safe for concurrent use.
+type CampaignDetector struct {
+	mu     sync.Mutex
+	config Config
+	recent *index.Index[uint64, *arrival]
+	queue  arrivals
+	next   uint64
+}
+
+// NewDetector returns a CampaignDetector with the given configuration.
+func NewDetector(config Config) (*CampaignDetector, error) {
+	if config.Window <= 0 {
+		return nil, errors.New("Window must be positive")
+	}
+	if config.Size < 1 {
+		return nil, errors.New("Size must be at least 1")
+	}
+	if config.Params == (spamsum.Params{}) {
+		config.Params = spamsum.DefaultParams
+	}
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
+	return &CampaignDetector{
+		config: config,
+		recent: index.NewWithParams[uint64, *arrival](config.Params),
+	}, nil
+}
+
+// Observe adds the SpamSum of a message, received at the given time,
+// under id.  It returns an Event if the message makes its group reach
+// the configured size; a group is reported once, however much it
+// grows afterwards.  Messages older than the window are ignored.
+// Returns spamsum.ErrParamsMismatch for SpamSums made with other
+// parameters than the configured ones.
+func (d *CampaignDetector) Observe(id string, sum *spamsum.SpamSum, at time.Time) (*Event, error) {
+	if sum.Params() != d.config.Params {
+		return nil, spamsum.ErrParamsMismatch
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := d.expire()
+	if !at.After(cutoff) {
+		return nil, nil
+	}
+
+	a := &arrival{key: d.next, id: id, at: at}
+	d.next++
+
+	threshold := max(d.config.Threshold, 1)
+	if matches := d.recent.Search(sum, threshold); len(matches) > 0 {
+		a.group = matches[0].Value.group
+	} else {
+		a.group = &group{id: a.key, sum: sum, members: make(map[uint64]*arrival)}
+	}
+	a.group.members[a.key] = a
+
+	if err := d.recent.Add(a.key, sum, a); err != nil {
+		return nil, err
+	}
+	heap.Push(&d.queue, a)
+
+	g := a.group
+	if g.reported || len(g.members) < d.config.Size {
+		return nil, nil
+	}
+	g.reported = true
+	return g.event(), nil
+}
+
+// event describes g as it is now.
+func (g *group) event() *Event {
+	members := make([]*arrival, 0, len(g.members))
+	for _, a := range g.members {
+		members = append(members, a)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].at.Equal(members[j].at) {
+			return members[i].at.Before(members[j].at)
+		}
+		return members[i].key < members[j].key
+	})
+
+	event := &Event{
+		Group: g.id,
+		First: members[0].at,
+		Last:  members[len(members)-1].at,
+		Sum:   g.sum,
+	}
+	for _, a := range members {
+		event.IDs = append(event.IDs, a.id)
+	}
+	return event
+}
+
+// Expire forgets the messages that have left the window.  Observe
+// does this as well, so Expire is only needed to release memory while
+// no messages arrive.
+func (d *CampaignDetector) Expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire()
+}
+
+// expire removes arrivals older than the window, and returns the
+// start of the window.
+func (d *CampaignDetector) expire() time.Time {
+	cutoff := d.config.Clock.Now().Add(-d.config.Window)
+	for len(d.queue) > 0 && !d.queue[0].at.After(cutoff) {
+		a := heap.Pop(&d.queue).(*arrival)
+		d.recent.Remove(a.key)
+		delete(a.group.members, a.key)
+	}
+
+	if d.recent.Tombstones() > d.recent.Len() {
+		d.recent.Compact()
+	}
+	return cutoff
+}
+
+// Len returns the number of messages in the window.
+func (d *CampaignDetector) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.queue)
+}
@@ -0,0 +1,153 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package campaign
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// messages returns the SpamSums of count variants of one random
+// message, each with a few bytes changed.
+func messages(random *rand.Rand, count int) []*spamsum.SpamSum {
+	base := make([]byte, 8000)
+	random.Read(base)
+
+	sums := make([]*spamsum.SpamSum, count)
+	for i := range sums {
+		variant := append([]byte(nil), base...)
+		copy(variant[random.Intn(len(variant)-20):], fmt.Sprintf("recipient %d", i))
+		sums[i] = spamsum.HashBytes(variant)
+	}
+	return sums
+}
+
+func newDetector(t *testing.T, clock Clock) *CampaignDetector {
+	d, err := NewDetector(Config{
+		Window:    10 * time.Minute,
+		Threshold: 80,
+		Size:      5,
+		Clock:     clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCampaignDetected(t *testing.T) {
+	random := rand.New(rand.NewSource(49))
+	campaign, unrelated := messages(random, 6), messages(random, 1)[0]
+	clock := &fakeClock{time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)}
+	d := newDetector(t, clock)
+
+	if event, _ := d.Observe("other", unrelated, clock.now); event != nil {
+		t.Errorf("A single message was reported: %v", event)
+	}
+	for i, sum := range campaign {
+		clock.now = clock.now.Add(time.Minute)
+		event, err := d.Observe(fmt.Sprint("spam ", i), sum, clock.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case i < 4 && event != nil:
+			t.Errorf("Group of %d was reported", i+1)
+		case i == 4 && event == nil:
+			t.Error("Group of 5 was not reported")
+		case i == 4:
+			if fmt.Sprint(event.IDs) != "[spam 0 spam 1 spam 2 spam 3 spam 4]" {
+				t.Errorf("Event lists %v", event.IDs)
+			}
+			if event.Last.Sub(event.First) != 4*time.Minute || event.Sum != campaign[0] {
+				t.Errorf("Event %v does not describe the group", event)
+			}
+		case i > 4 && event != nil:
+			t.Error("A group should be reported once")
+		}
+	}
+}
+
+func TestCampaignWindow(t *testing.T) {
+	random := rand.New(rand.NewSource(49))
+	campaign := messages(random, 20)
+	clock := &fakeClock{time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)}
+	d := newDetector(t, clock)
+
+	// at most four messages fit in the window at a time
+	for i, sum := range campaign {
+		clock.now = clock.now.Add(3 * time.Minute)
+		if event, _ := d.Observe(fmt.Sprint(i), sum, clock.now); event != nil {
+			t.Fatalf("A slow trickle was reported: %v", event.IDs)
+		}
+		if d.Len() > 4 {
+			t.Fatalf("%d messages in a window that fits 4", d.Len())
+		}
+	}
+
+	// messages older than the window are ignored
+	if event, _ := d.Observe("late", campaign[0], clock.now.Add(-time.Hour)); event != nil || d.Len() > 4 {
+		t.Error("An old message counted")
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	d.Expire()
+	if d.Len() != 0 || d.recent.Len() != 0 || d.recent.Tombstones() > d.recent.Len() {
+		t.Errorf("%d messages left after the window passed", d.Len())
+	}
+}
+
+func TestCampaignOutOfOrder(t *testing.T) {
+	random := rand.New(rand.NewSource(49))
+	campaign := messages(random, 5)
+	start := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{start.Add(9 * time.Minute)}
+	d := newDetector(t, clock)
+
+	var event *Event
+	for i, minute := range []int{8, 0, 4, 2, 6} {
+		event, _ = d.Observe(fmt.Sprint(i), campaign[i], start.Add(time.Duration(minute)*time.Minute))
+	}
+	if event == nil || event.First != start || fmt.Sprint(event.IDs) != "[1 3 2 4 0]" {
+		t.Fatalf("Out of order arrivals reported as %v", event)
+	}
+
+	// the message of minute 0 expires first
+	clock.now = start.Add(10*time.Minute + time.Second)
+	d.Expire()
+	if d.Len() != 4 {
+		t.Errorf("%d messages in the window, expected 4", d.Len())
+	}
+}
+
+func TestNewDetectorValidates(t *testing.T) {
+	for _, config := range []Config{
+		{Window: 0, Size: 5},
+		{Window: time.Minute, Size: 0},
+	} {
+		if _, err := NewDetector(config); err == nil {
+			t.Errorf("Config %v should be refused", config)
+		}
+	}
+
+	d, _ := NewDetector(Config{Window: time.Minute, Size: 2})
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if _, err := d.Observe("long", hasher.HashBytes([]byte("fox")), time.Now()); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Observing a sum with other parameters returned %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Command capi is a shared library that can stand in for ssdeep's
+// libfuzzy.  Build it with
+//
+//	go build -buildmode=c-shared -o libfuzzy.so ./capi
+//
+// and link C programs against it, using fuzzy.h from this directory.
+// Hashes are identical to those of libfuzzy.  Scores returned by
+// fuzzy_compare are those of SpamSum.Compare, which are not always
+// identical to those of ssdeep.
+//
+// The streaming functions (fuzzy_new, fuzzy_update and fuzzy_digest)
+// keep all data passed to fuzzy_update in memory, since the block size
+// can only be chosen once the whole input has been seen.
+package main
+
+/*
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+struct fuzzy_state {
+	uintptr_t handle;
+};
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+const (
+	flagEliminateSequences = 0x1
+	flagNoTruncate         = 0x2
+
+	maxResult = 2*spamsum.SpamsumLength + 20
+)
+
+// state is the data collected by fuzzy_update.
+type state struct {
+	data []byte
+}
+
+func main() {}
+
+func newState(s *state) *C.struct_fuzzy_state {
+	handle := (*C.struct_fuzzy_state)(C.malloc(C.size_t(unsafe.Sizeof(C.struct_fuzzy_state{}))))
+	if handle == nil {
+		return nil
+	}
+	handle.handle = C.uintptr_t(cgo.NewHandle(s))
+	return handle
+}
+
+func getState(handle *C.struct_fuzzy_state) *state {
+	return cgo.Handle(handle.handle).Value().(*state)
+}
+
+// writeResult copies digest into the FUZZY_MAX_RESULT sized buffer
+// result, terminated with a NUL byte.
+func writeResult(result *C.char, digest string) {
+	buffer := unsafe.Slice((*byte)(unsafe.Pointer(result)), maxResult)
+	n := copy(buffer[:maxResult-1], digest)
+	buffer[n] = 0
+}
+
+// hash writes the SpamSum of data, formatted according to flags, to
+// result.
+func hash(data []byte, result *C.char, flags uint) C.int {
+	options := spamsum.DigestOptions{
+		EliminateSequences: flags&flagEliminateSequences != 0,
+		NoTruncate:         flags&flagNoTruncate != 0,
+	}
+	writeResult(result, spamsum.HashBytesOptions(data, options).String())
+	return 0
+}
+
+//export fuzzy_new
+func fuzzy_new() *C.struct_fuzzy_state {
+	return newState(&state{})
+}
+
+//export fuzzy_clone
+func fuzzy_clone(handle *C.struct_fuzzy_state) *C.struct_fuzzy_state {
+	return newState(&state{append([]byte(nil), getState(handle).data...)})
+}
+
+//export fuzzy_update
+func fuzzy_update(handle *C.struct_fuzzy_state, buffer *C.uchar, size C.size_t) C.int {
+	s := getState(handle)
+	if size > 0 {
+		s.data = append(s.data, unsafe.Slice((*byte)(unsafe.Pointer(buffer)), int(size))...)
+	}
+	return 0
+}
+
+//export fuzzy_digest
+func fuzzy_digest(handle *C.struct_fuzzy_state, result *C.char, flags C.uint) C.int {
+	return hash(getState(handle).data, result, uint(flags))
+}
+
+//export fuzzy_free
+func fuzzy_free(handle *C.struct_fuzzy_state) {
+	if handle == nil {
+		return
+	}
+	cgo.Handle(handle.handle).Delete()
+	C.free(unsafe.Pointer(handle))
+}
+
+//export fuzzy_hash_buf
+func fuzzy_hash_buf(buf *C.uchar, length C.uint32_t, result *C.char) C.int {
+	var data []byte
+	if length > 0 {
+		data = unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(length))
+	}
+	return hash(data, result, 0)
+}
+
+// readStream reads handle from its current position up to the end.
+func readStream(handle *C.FILE) ([]byte, bool) {
+	data := make([]byte, 0)
+	block := make([]byte, spamsum.ReadSize)
+	for {
+		n := C.fread(unsafe.Pointer(&block[0]), 1, C.size_t(len(block)), handle)
+		data = append(data, block[:n]...)
+		if n < C.size_t(len(block)) {
+			return data, C.ferror(handle) == 0
+		}
+	}
+}
+
+//export fuzzy_hash_stream
+func fuzzy_hash_stream(handle *C.FILE, result *C.char) C.int {
+	data, ok := readStream(handle)
+	if !ok {
+		return -1
+	}
+	return hash(data, result, 0)
+}
+
+//export fuzzy_hash_file
+func fuzzy_hash_file(handle *C.FILE, result *C.char) C.int {
+	position := C.ftell(handle)
+	if position < 0 || C.fseek(handle, 0, C.SEEK_SET) != 0 {
+		return -1
+	}
+
+	status := fuzzy_hash_stream(handle, result)
+	if C.fseek(handle, position, C.SEEK_SET) != 0 {
+		return -1
+	}
+	return status
+}
+
+//export fuzzy_hash_filename
+func fuzzy_hash_filename(filename *C.char, result *C.char) C.int {
+	data, err := os.ReadFile(C.GoString(filename))
+	if err != nil {
+		return -1
+	}
+	return hash(data, result, 0)
+}
+
+//export fuzzy_compare
+func fuzzy_compare(sig1, sig2 *C.char) C.int {
+	var from, to spamsum.SpamSum
+	if _, err := fmt.Sscan(C.GoString(sig1), &from); err != nil {
+		return -1
+	}
+	if _, err := fmt.Sscan(C.GoString(sig2), &to); err != nil {
+		return -1
+	}
+	return C.int(from.Compare(to))
+}
@@ -0,0 +1,92 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// TestSharedLibrary builds the shared library, links the C harness in
+// testdata against it, and checks its output against the Go API.
+func TestSharedLibrary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping shared library build in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("shared library test only runs on linux")
+	}
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc not found")
+	}
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libfuzzy.so")
+	harness := filepath.Join(dir, "harness")
+
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", library, ".")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building shared library: %v\n%s", err, output)
+	}
+	link := exec.Command(cc, "-o", harness, filepath.Join("testdata", "harness.c"),
+		"-I.", "-L"+dir, "-lfuzzy")
+	if output, err := link.CombinedOutput(); err != nil {
+		t.Fatalf("linking harness: %v\n%s", err, output)
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "*"))
+	if err != nil || len(files) < 2 {
+		t.Fatal("test files not found")
+	}
+
+	sums := make([]*spamsum.SpamSum, len(files))
+	flagged := make([]string, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums[i] = spamsum.HashBytes(data)
+		flagged[i] = spamsum.HashBytesOptions(data, spamsum.DigestOptions{
+			EliminateSequences: true, NoTruncate: true}).String()
+	}
+
+	run := exec.Command(harness, files...)
+	run.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	run.Stderr = os.Stderr
+	output, err := run.Output()
+	if err != nil {
+		t.Fatalf("running harness: %v", err)
+	}
+
+	var expected []string
+	for i, sum := range sums {
+		expected = append(expected, sum.String()+" "+flagged[i])
+	}
+	for i := range sums {
+		for j := range sums {
+			expected = append(expected,
+				fmt.Sprintf("%d %d %d", i, j, sums[i].Compare(*sums[j])))
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for i := 0; scanner.Scan(); i++ {
+		if i >= len(expected) {
+			t.Fatalf("unexpected output %q", scanner.Text())
+		} else if scanner.Text() != expected[i] {
+			t.Errorf("line %d: %q, expected %q", i, scanner.Text(), expected[i])
+		}
+	}
+}
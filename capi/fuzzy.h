@@ -0,0 +1,49 @@
+/* Copyright 2013, Michiel Buddingh, All rights reserved.  Use of this
+   code is governed by version 2.0 or later of the Apache License,
+   available at http://www.apache.org/licenses/LICENSE-2.0
+
+   Declarations for the libfuzzy compatible shared library built from
+   this directory with `go build -buildmode=c-shared`.  They mirror
+   those of ssdeep's fuzzy.h, so existing C code can be linked against
+   it unchanged. */
+
+#ifndef FUZZY_H
+#define FUZZY_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define FUZZY_FLAG_ELIMSEQ 0x1u
+#define FUZZY_FLAG_NOTRUNC 0x2u
+
+#define SPAMSUM_LENGTH 64
+#define FUZZY_MAX_RESULT (2 * SPAMSUM_LENGTH + 20)
+
+struct fuzzy_state;
+
+extern struct fuzzy_state *fuzzy_new(void);
+extern struct fuzzy_state *fuzzy_clone(const struct fuzzy_state *state);
+extern int fuzzy_update(struct fuzzy_state *state,
+			const unsigned char *buffer, size_t buffer_size);
+extern int fuzzy_digest(const struct fuzzy_state *state,
+			char *result, unsigned int flags);
+extern void fuzzy_free(struct fuzzy_state *state);
+
+extern int fuzzy_hash_buf(const unsigned char *buf, uint32_t buf_len,
+			  char *result);
+extern int fuzzy_hash_file(FILE *handle, char *result);
+extern int fuzzy_hash_stream(FILE *handle, char *result);
+extern int fuzzy_hash_filename(const char *filename, char *result);
+
+extern int fuzzy_compare(const char *sig1, const char *sig2);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,88 @@
+/* Copyright 2013, Michiel Buddingh, All rights reserved.  Use of this
+   code is governed by version 2.0 or later of the Apache License,
+   available at http://www.apache.org/licenses/LICENSE-2.0
+
+   Test harness for the C API.  Hashes every file named on the command
+   line with each of the hashing functions, and prints one line per
+   file with its digest and its digest with all flags set, followed by
+   one line per pair of files with their fuzzy_compare score.  Exits
+   with a non-zero status if the functions disagree. */
+
+#include <stdlib.h>
+#include <string.h>
+
+#include "fuzzy.h"
+
+static int hash_all(const char *filename, char *result, char *flagged)
+{
+	char other[FUZZY_MAX_RESULT];
+	unsigned char chunk[1000];
+	struct fuzzy_state *state, *clone;
+	unsigned char *data = NULL;
+	size_t length = 0, n;
+	FILE *handle;
+
+	if (fuzzy_hash_filename(filename, result) != 0)
+		return -1;
+
+	if ((handle = fopen(filename, "rb")) == NULL)
+		return -1;
+	state = fuzzy_new();
+	while ((n = fread(chunk, 1, sizeof(chunk), handle)) > 0) {
+		fuzzy_update(state, chunk, n);
+		data = realloc(data, length + n);
+		memcpy(data + length, chunk, n);
+		length += n;
+	}
+	clone = fuzzy_clone(state);
+	fuzzy_free(state);
+	if (fuzzy_digest(clone, other, 0) != 0 || strcmp(result, other))
+		return -1;
+	if (fuzzy_digest(clone, flagged,
+			 FUZZY_FLAG_ELIMSEQ | FUZZY_FLAG_NOTRUNC) != 0)
+		return -1;
+	fuzzy_free(clone);
+
+	if (fuzzy_hash_buf(data, length, other) != 0 || strcmp(result, other))
+		return -1;
+	free(data);
+
+	fseek(handle, 10, SEEK_SET);
+	if (fuzzy_hash_file(handle, other) != 0 || strcmp(result, other))
+		return -1;
+	if (ftell(handle) != 10)
+		return -1;
+
+	rewind(handle);
+	if (fuzzy_hash_stream(handle, other) != 0 || strcmp(result, other))
+		return -1;
+	fclose(handle);
+	return 0;
+}
+
+int main(int argc, char **argv)
+{
+	char (*results)[FUZZY_MAX_RESULT];
+	char flagged[FUZZY_MAX_RESULT];
+	int i, j;
+
+	results = calloc(argc, FUZZY_MAX_RESULT);
+	for (i = 1; i < argc; i++) {
+		if (hash_all(argv[i], results[i], flagged) != 0) {
+			fprintf(stderr, "%s: hashes differ\n", argv[i]);
+			return 1;
+		}
+		printf("%s %s\n", results[i], flagged);
+	}
+
+	for (i = 1; i < argc; i++)
+		for (j = 1; j < argc; j++)
+			printf("%d %d %d\n", i - 1, j - 1,
+			       fuzzy_compare(results[i], results[j]));
+
+	if (fuzzy_compare("not a digest", results[1]) != -1) {
+		fprintf(stderr, "invalid digest accepted\n");
+		return 1;
+	}
+	return 0;
+}
@@ -0,0 +1,245 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package classify labels SpamSums by the labels of the most similar
+// SpamSums it was trained with: a k-nearest-neighbours classifier,
+// with Compare scores as the measure of similarity.
+//
+// Labels are arbitrary strings, like "spam" and "ham", or the names of
+// malware families.
+package classify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+// Weighting decides how much the vote of a neighbour counts.
+type Weighting int
+
+const (
+	// Uniform gives every neighbour one vote.
+	Uniform Weighting = iota
+	// Linear weighs every vote by the score of the neighbour.
+	Linear
+	// Squared weighs every vote by the square of the score, so a
+	// close neighbour outvotes several distant ones.
+	Squared
+)
+
+// weight returns the vote of a neighbour with the given score.
+func (w Weighting) weight(score uint32) float64 {
+	switch w {
+	case Linear:
+		return float64(score)
+	case Squared:
+		return float64(score) * float64(score)
+	default:
+		return 1
+	}
+}
+
+// Config sets the behaviour of a Classifier.
+type Config struct {
+	// K is the number of neighbours that vote.
+	K int
+	// MinScore is the score a neighbour needs to vote at all; a
+	// query without such neighbours is not classified.
+	MinScore uint32
+	// Weighting decides the weight of every vote.
+	Weighting Weighting
+	// Params are the parameters of the SpamSums; zero means
+	// spamsum.DefaultParams.
+	Params spamsum.Params
+}
+
+// DefaultConfig lets the five nearest neighbours scoring at least 30
+// vote, weighted by their scores.
+var DefaultConfig = Config{K: 5, MinScore: 30, Weighting: Linear}
+
+// A Neighbour is a training sample that voted on a classification.
+type Neighbour struct {
+	Label string
+	Sum   *spamsum.SpamSum
+	Score uint32
+}
+
+// A Prediction is the outcome of a classification.  Confidence is the
+// share of the total weight of the votes cast for Label, between 0
+// and 1.  Neighbours are those that voted, best first.
+type Prediction struct {
+	Label      string
+	Confidence float64
+	Neighbours []Neighbour
+}
+
+// A Classifier is trained by adding labelled SpamSums, and then labels
+// others.  It is safe for concurrent use.
+type Classifier struct {
+	mu      sync.Mutex
+	config  Config
+	samples *index.Index[int, string]
+	next    int
+}
+
+// New returns an untrained Classifier.
+func New(config Config) (*Classifier, error) {
+	if config.K < 1 {
+		return nil, errors.New("K must be at least 1")
+	}
+	if config.Weighting < Uniform || config.Weighting > Squared {
+		return nil, errors.New("Unknown weighting")
+	}
+	if config.Params == (spamsum.Params{}) {
+		config.Params = spamsum.DefaultParams
+	}
+
+	return &Classifier{
+		config:  config,
+		samples: index.NewWithParams[int, string](config.Params),
+	}, nil
+}
+
+// Config returns the configuration of the Classifier.
+func (c *Classifier) Config() Config {
+	return c.config
+}
+
+// Add trains the Classifier with sum, labelled label.  Returns
+// spamsum.ErrParamsMismatch if sum was made with other parameters than
+// the configured ones.
+func (c *Classifier) Add(sum *spamsum.SpamSum, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.samples.Add(c.next, sum, label); err != nil {
+		return err
+	}
+	c.next++
+	return nil
+}
+
+// Len returns the number of training samples.
+func (c *Classifier) Len() int {
+	return c.samples.Len()
+}
+
+// Classify predicts the label of query from the votes of its K
+// nearest neighbours scoring at least MinScore.  The label with the
+// most weight wins; between equal weights, the label of the best
+// neighbour.  Returns false if no neighbour scores high enough.
+func (c *Classifier) Classify(query *spamsum.SpamSum) (Prediction, bool) {
+	matches := c.samples.Search(query, c.config.MinScore)
+	if len(matches) == 0 {
+		return Prediction{}, false
+	}
+	if len(matches) > c.config.K {
+		matches = matches[:c.config.K]
+	}
+
+	var prediction Prediction
+	votes := make(map[string]float64)
+	total := 0.0
+	for _, match := range matches {
+		weight := c.config.Weighting.weight(match.Score)
+		votes[match.Value] += weight
+		total += weight
+		prediction.Neighbours = append(prediction.Neighbours,
+			Neighbour{match.Value, match.Sum, match.Score})
+	}
+
+	// neighbours are best first, so the first label to reach the
+	// highest weight is that of the best neighbour.
+	best := -1.0
+	for _, neighbour := range prediction.Neighbours {
+		if votes[neighbour.Label] > best {
+			best = votes[neighbour.Label]
+			prediction.Label = neighbour.Label
+		}
+	}
+	prediction.Confidence = best / total
+	return prediction, true
+}
+
+const modelHeader = "spamsum-classifier"
+
+// Save writes the configuration and training samples of the
+// Classifier to w, in a line-oriented text format that Load reads
+// back.  The first line holds the configuration and the number of
+// samples, each following line a SpamSum and its quoted label.
+func (c *Classifier) Save(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writer := bufio.NewWriter(w)
+	config := c.config
+	if _, err := fmt.Fprintf(writer, "%s %d %d %d %d %d %d %d\n", modelHeader,
+		config.Params.SignatureLength, config.Params.Window, config.Params.MinBlockSize,
+		config.K, config.MinScore, config.Weighting, c.samples.Len()); err != nil {
+		return err
+	}
+	for entry := range c.samples.All() {
+		if _, err := fmt.Fprintf(writer, "%v %s\n", entry.Sum, strconv.Quote(entry.Value)); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Load reads a Classifier written by Save.
+func Load(r io.Reader) (*Classifier, error) {
+	reader := bufio.NewReader(r)
+
+	var header string
+	var config Config
+	var samples int
+	if _, err := fmt.Fscanf(reader, "%s %d %d %d %d %d %d %d\n", &header,
+		&config.Params.SignatureLength, &config.Params.Window, &config.Params.MinBlockSize,
+		&config.K, &config.MinScore, &config.Weighting, &samples); err != nil {
+		return nil, err
+	} else if header != modelHeader {
+		return nil, errors.New("Not a spamsum classifier")
+	}
+
+	hasher, err := spamsum.NewHasher(config.Params)
+	if err != nil {
+		return nil, err
+	}
+	c, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < samples; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		digest, quoted, found := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		if !found {
+			return nil, errors.New("Invalid classifier sample")
+		}
+		label, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hasher.Parse(digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Add(sum, label); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package classify
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// variant returns a copy of base with edits random 40-byte stretches
+// overwritten.
+func variant(random *rand.Rand, base []byte, edits int) []byte {
+	input := append([]byte(nil), base...)
+	for i := 0; i < edits; i++ {
+		start := random.Intn(len(input) - 40)
+		random.Read(input[start : start+40])
+	}
+	return input
+}
+
+// families returns a random base input for each label.
+func families(random *rand.Rand, labels ...string) map[string][]byte {
+	bases := make(map[string][]byte)
+	for _, label := range labels {
+		bases[label] = make([]byte, 10000)
+		random.Read(bases[label])
+	}
+	return bases
+}
+
+func TestClassify(t *testing.T) {
+	random := rand.New(rand.NewSource(50))
+	labels := []string{"spam", "ham", "malware family x"}
+	bases := families(random, labels...)
+
+	c, err := New(DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range labels {
+		for i := 0; i < 5; i++ {
+			if err := c.Add(spamsum.HashBytes(variant(random, bases[label], 3)), label); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if c.Len() != 15 {
+		t.Errorf("Classifier holds %d samples, expected 15", c.Len())
+	}
+
+	for _, label := range labels {
+		prediction, ok := c.Classify(spamsum.HashBytes(variant(random, bases[label], 3)))
+		if !ok || prediction.Label != label {
+			t.Errorf("A variant of %s was classified as %q", label, prediction.Label)
+			continue
+		}
+		if prediction.Confidence != 1 || len(prediction.Neighbours) != DefaultConfig.K {
+			t.Errorf("Prediction %v should have 5 unanimous neighbours", prediction)
+		}
+		for i, neighbour := range prediction.Neighbours {
+			if neighbour.Score < DefaultConfig.MinScore || (i > 0 && prediction.Neighbours[i-1].Score < neighbour.Score) {
+				t.Errorf("Neighbours %v not ordered, or below the minimum score", prediction.Neighbours)
+			}
+		}
+	}
+
+	unrelated := make([]byte, 10000)
+	random.Read(unrelated)
+	if prediction, ok := c.Classify(spamsum.HashBytes(unrelated)); ok {
+		t.Errorf("Unrelated input classified as %v", prediction)
+	}
+}
+
+func TestWeighting(t *testing.T) {
+	random := rand.New(rand.NewSource(50))
+	base := families(random, "base")["base"]
+
+	// one close spam neighbour, two distant ham ones
+	query := spamsum.HashBytes(base)
+	spam := spamsum.HashBytes(variant(random, base, 1))
+	ham := []*spamsum.SpamSum{
+		spamsum.HashBytes(variant(random, base, 30)),
+		spamsum.HashBytes(variant(random, base, 30)),
+	}
+	for _, sum := range ham {
+		if score, close := query.Compare(*sum), query.Compare(*spam); score*score*2 >= close*close || score*2 <= close {
+			t.Fatalf("Test inputs score %d and %d, need other inputs", score, close)
+		}
+	}
+
+	for _, test := range []struct {
+		weighting  Weighting
+		label      string
+		confidence float64
+	}{
+		{Uniform, "ham", 2.0 / 3},
+		{Linear, "ham", 0},
+		{Squared, "spam", 0},
+	} {
+		c, err := New(Config{K: 3, MinScore: 1, Weighting: test.weighting})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Add(spam, "spam")
+		for _, sum := range ham {
+			c.Add(sum, "ham")
+		}
+
+		prediction, ok := c.Classify(query)
+		if !ok || prediction.Label != test.label {
+			t.Errorf("Weighting %d predicts %q, expected %q", test.weighting, prediction.Label, test.label)
+		}
+		if test.confidence != 0 && prediction.Confidence != test.confidence {
+			t.Errorf("Weighting %d has confidence %f, expected %f", test.weighting, prediction.Confidence, test.confidence)
+		}
+		if prediction.Confidence <= 0.5 || prediction.Confidence > 1 {
+			t.Errorf("Winning label has confidence %f", prediction.Confidence)
+		}
+	}
+
+	// with k=1 or a high minimum score only the spam neighbour votes
+	for _, config := range []Config{
+		{K: 1, MinScore: 1, Weighting: Uniform},
+		{K: 3, MinScore: query.Compare(*spam), Weighting: Uniform},
+	} {
+		c, _ := New(config)
+		c.Add(spam, "spam")
+		for _, sum := range ham {
+			c.Add(sum, "ham")
+		}
+		if prediction, _ := c.Classify(query); prediction.Label != "spam" || len(prediction.Neighbours) != 1 {
+			t.Errorf("Config %v predicts %v", config, prediction)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	random := rand.New(rand.NewSource(50))
+	labels := []string{"spam", "ham", "label with \"quotes\"\n"}
+	bases := families(random, labels...)
+
+	config := Config{K: 4, MinScore: 20, Weighting: Squared}
+	c, _ := New(config)
+	var queries []*spamsum.SpamSum
+	for _, label := range labels {
+		for i := 0; i < 4; i++ {
+			c.Add(spamsum.HashBytes(variant(random, bases[label], 6)), label)
+		}
+		queries = append(queries, spamsum.HashBytes(variant(random, bases[label], 6)))
+	}
+
+	var saved bytes.Buffer
+	if err := c.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Config() != c.Config() || loaded.Len() != c.Len() {
+		t.Errorf("Loaded %v with %d samples, expected %v with %d", loaded.Config(), loaded.Len(), c.Config(), c.Len())
+	}
+
+	for _, query := range queries {
+		expected, _ := c.Classify(query)
+		actual, _ := loaded.Classify(query)
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("Loaded classifier predicts %v, expected %v", actual, expected)
+		}
+	}
+
+	var again bytes.Buffer
+	loaded.Save(&again)
+	if again.String() != saved.String() {
+		t.Error("Saving a loaded classifier produced different output")
+	}
+
+	for _, model := range []string{
+		"",
+		"spamsum-index 64 7 3 5 30 1 0\n",
+		"spamsum-classifier 64 7 3 0 30 1 0\n",
+		"spamsum-classifier 64 7 3 5 30 1 1\n",
+		"spamsum-classifier 64 7 3 5 30 1 1\n3:abc:de unquoted\n",
+	} {
+		if _, err := Load(strings.NewReader(model)); err == nil {
+			t.Errorf("Loading %q should fail", model)
+		}
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	for _, config := range []Config{
+		{K: 0},
+		{K: 1, Weighting: Squared + 1},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("Config %v should be refused", config)
+		}
+	}
+
+	c, _ := New(DefaultConfig)
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if err := c.Add(hasher.HashBytes([]byte("fox")), "spam"); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Adding a sum with other parameters returned %v", err)
+	}
+}
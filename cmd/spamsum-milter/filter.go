@@ -0,0 +1,82 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"unicode"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+const rejectReply = "550 5.7.1 Message matches known spam"
+
+// filter holds the configuration shared by all sessions.  Messages
+// scoring at least reject against the known spam are rejected; a
+// reject of 0 never rejects.
+type filter struct {
+	known     *index.Index[string, struct{}]
+	reject    uint32
+	header    string
+	normalize bool
+	maxBody   int64
+}
+
+// verdict is the outcome of checking a message: its best score
+// against the known spam, and whether to reject it.
+type verdict struct {
+	score  uint32
+	reject bool
+}
+
+func (f *filter) check(header textproto.MIMEHeader, body []byte) verdict {
+	if f.normalize {
+		body = normalize(header, body)
+	}
+
+	var v verdict
+	if matches := f.known.Search(spamsum.HashBytes(body), 1); len(matches) > 0 {
+		v.score = matches[0].Score
+	}
+	v.reject = f.reject > 0 && v.score >= f.reject
+	return v
+}
+
+// readKnown reads a file of known spam digests, one per line,
+// optionally followed by whitespace and an ID.  Entries without an ID
+// are named after their line number.  Empty lines and lines starting
+// with # are skipped.
+func readKnown(r io.Reader) (*index.Index[string, struct{}], error) {
+	known := index.New[string, struct{}]()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		digest, id := text, ""
+		if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+			digest, id = text[:i], strings.TrimSpace(text[i:])
+		}
+		if id == "" {
+			id = fmt.Sprintf("line %d", line)
+		}
+
+		sum := new(spamsum.SpamSum)
+		if _, err := fmt.Sscan(digest, sum); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := known.Add(id, sum, struct{}{}); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return known, scanner.Err()
+}
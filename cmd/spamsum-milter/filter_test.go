@@ -0,0 +1,60 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestReadKnown(t *testing.T) {
+	known, err := readKnown(strings.NewReader(`# known spam
+3:FJKKIUKact:FHIGi fox
+3:FJKKIUKact:FHIGi	fox, tab separated
+
+  96:Zly/LzhCdpakSQPnRSmFLhRyuIgMdg8LvSzJBp43BfF7cFblTLNpk6dKhIBBLrG:GvhSpsQ4OhbMdvaBi3UnXjvC
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known.Len() != 3 {
+		t.Errorf("Read %d digests, expected 3", known.Len())
+	}
+	if _, _, ok := known.Get("fox"); !ok {
+		t.Error("Digest with ID not found")
+	}
+	if _, _, ok := known.Get("fox, tab separated"); !ok {
+		t.Error("Digest with a tab separated ID not found")
+	}
+	if _, _, ok := known.Get("line 5"); !ok {
+		t.Error("Digest without ID not named after its line")
+	}
+
+	for _, invalid := range []string{"bogus\n", "3:abc:de a\n3:abc:de a\n"} {
+		if _, err := readKnown(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Reading %q should fail", invalid)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f := testFilter(t, 90)
+	header := make(textproto.MIMEHeader)
+
+	if v := f.check(header, []byte(spamText())); v.score != 100 || !v.reject {
+		t.Errorf("Known spam got %+v", v)
+	}
+
+	f.normalize = false
+	if v := f.check(header, []byte(spamText())); v.score == 100 {
+		t.Errorf("Spam with CRLF line endings should not match exactly without normalization, got %+v", v)
+	}
+
+	f.reject = 0
+	if v := f.check(header, []byte(spamText())); v.reject {
+		t.Error("A reject threshold of 0 should never reject")
+	}
+}
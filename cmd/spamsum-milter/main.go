@@ -0,0 +1,82 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Command spamsum-milter is a Sendmail/Postfix milter that scores mail
+// against a set of known spam digests.  Every message body is hashed,
+// after MIME normalization unless -normalize=false, and compared to
+// the digests in the -known file.  Messages scoring at least -reject
+// are rejected; all others get a header holding their score.
+//
+// The -known file holds one digest per line, optionally followed by
+// whitespace and an ID.  Empty lines and lines starting with # are
+// skipped.
+//
+// -listen takes a network and an address, separated by a colon:
+//
+//	spamsum-milter -listen unix:/var/run/spamsum.sock -known spam.txt
+//	spamsum-milter -listen tcp:127.0.0.1:8890 -known spam.txt -reject 80
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+func main() {
+	listen := flag.String("listen", "tcp:127.0.0.1:8890", "network:address to listen on")
+	known := flag.String("known", "", "file of known spam digests")
+	reject := flag.Uint("reject", 0, "reject messages scoring at least this; 0 never rejects")
+	header := flag.String("header", "X-Spamsum-Score", "name of the score header")
+	normalize := flag.Bool("normalize", true, "decode MIME parts before hashing")
+	maxBody := flag.Int64("max-body", 10<<20, "maximum number of body bytes hashed")
+	flag.Parse()
+
+	if *known == "" {
+		log.Fatal("-known is required")
+	}
+	file, err := os.Open(*known)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f := &filter{
+		reject:    uint32(*reject),
+		header:    *header,
+		normalize: *normalize,
+		maxBody:   *maxBody,
+	}
+	f.known, err = readKnown(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", *known, err)
+	}
+	log.Printf("loaded %d known spam digests", f.known.Len())
+
+	network, address, found := strings.Cut(*listen, ":")
+	if !found {
+		log.Fatalf("invalid -listen %q", *listen)
+	}
+	if network == "unix" {
+		os.Remove(address)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer conn.Close()
+			if err := f.serve(conn); err != nil {
+				log.Printf("%v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// Commands sent by the MTA, and the replies to them, as defined by
+// version 6 of the milter protocol.
+const (
+	cmdAbort    = 'A'
+	cmdBody     = 'B'
+	cmdConnect  = 'C'
+	cmdMacro    = 'D'
+	cmdEndBody  = 'E'
+	cmdHelo     = 'H'
+	cmdQuitNew  = 'K'
+	cmdHeader   = 'L'
+	cmdMail     = 'M'
+	cmdEOH      = 'N'
+	cmdOptNeg   = 'O'
+	cmdQuit     = 'Q'
+	cmdRcpt     = 'R'
+	cmdData     = 'T'
+	cmdUnknown  = 'U'
+	replyCont   = 'c'
+	replyAddHdr = 'h'
+	replyCode   = 'y'
+)
+
+const (
+	milterVersion = 6
+
+	// actionAddHeaders is the only modification the milter makes.
+	actionAddHeaders = 0x01
+
+	// the stages of the conversation the milter has no use for
+	protoNoConnect = 0x001
+	protoNoHelo    = 0x002
+	protoNoMail    = 0x004
+	protoNoRcpt    = 0x008
+	protoNoUnknown = 0x100
+	protoNoData    = 0x200
+	protoSkipped   = protoNoConnect | protoNoHelo | protoNoMail |
+		protoNoRcpt | protoNoUnknown | protoNoData
+
+	// maxPacket limits the size of a single packet; MTAs send
+	// the body in chunks of at most 64KB.
+	maxPacket = 1 << 20
+)
+
+var errPacketSize = errors.New("Milter packet too large")
+
+func readPacket(r io.Reader) (command byte, data []byte, err error) {
+	var length uint32
+	if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+		return
+	} else if length == 0 || length > maxPacket {
+		return 0, nil, errPacketSize
+	}
+
+	packet := make([]byte, length)
+	if _, err = io.ReadFull(r, packet); err != nil {
+		return
+	}
+	return packet[0], packet[1:], nil
+}
+
+func writePacket(w io.Writer, command byte, data []byte) error {
+	packet := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(packet, uint32(1+len(data)))
+	packet[4] = command
+	_, err := w.Write(append(packet, data...))
+	return err
+}
+
+// nulStrings splits data into its NUL-terminated strings.
+func nulStrings(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+}
+
+// session is the state of one connection from the MTA.  header and
+// body collect the message currently being received.
+type session struct {
+	conn   io.ReadWriter
+	filter *filter
+	header textproto.MIMEHeader
+	body   bytes.Buffer
+}
+
+func (s *session) reset() {
+	s.header = make(textproto.MIMEHeader)
+	s.body.Reset()
+}
+
+// serve handles the commands on conn until the MTA quits.
+func (f *filter) serve(conn io.ReadWriter) error {
+	s := &session{conn: conn, filter: f}
+	s.reset()
+
+	for {
+		command, data, err := readPacket(conn)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch command {
+		case cmdOptNeg:
+			err = s.negotiate(data)
+		case cmdMacro:
+			// macros need no reply
+		case cmdConnect, cmdHelo, cmdMail, cmdRcpt, cmdData, cmdUnknown, cmdEOH:
+			err = writePacket(conn, replyCont, nil)
+		case cmdHeader:
+			if fields := nulStrings(data); len(fields) == 2 {
+				s.header.Add(fields[0], strings.TrimSpace(fields[1]))
+			}
+			err = writePacket(conn, replyCont, nil)
+		case cmdBody:
+			s.addBody(data)
+			err = writePacket(conn, replyCont, nil)
+		case cmdEndBody:
+			s.addBody(data)
+			err = s.endOfMessage()
+			s.reset()
+		case cmdAbort, cmdQuitNew:
+			s.reset()
+		case cmdQuit:
+			return nil
+		default:
+			return fmt.Errorf("Unknown milter command %q", command)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// negotiate answers the option negotiation of the MTA, asking it to
+// skip the stages before the headers.
+func (s *session) negotiate(data []byte) error {
+	if len(data) < 12 {
+		return errors.New("Short option negotiation")
+	}
+	version := binary.BigEndian.Uint32(data)
+	actions := binary.BigEndian.Uint32(data[4:])
+	protocol := binary.BigEndian.Uint32(data[8:])
+	if version < 2 {
+		return fmt.Errorf("Unsupported milter protocol version %d", version)
+	} else if actions&actionAddHeaders == 0 {
+		return errors.New("MTA does not allow adding headers")
+	}
+
+	reply := make([]byte, 12)
+	binary.BigEndian.PutUint32(reply, min(version, milterVersion))
+	binary.BigEndian.PutUint32(reply[4:], actionAddHeaders)
+	binary.BigEndian.PutUint32(reply[8:], protocol&protoSkipped)
+	return writePacket(s.conn, cmdOptNeg, reply)
+}
+
+// addBody collects body data, up to the size limit of the filter.
+// Anything beyond it is ignored.
+func (s *session) addBody(data []byte) {
+	if room := s.filter.maxBody - int64(s.body.Len()); room < int64(len(data)) {
+		data = data[:max(room, 0)]
+	}
+	s.body.Write(data)
+}
+
+// endOfMessage scores the message, and either rejects it or adds a
+// header with its score.
+func (s *session) endOfMessage() error {
+	verdict := s.filter.check(s.header, s.body.Bytes())
+	if verdict.reject {
+		return writePacket(s.conn, replyCode, []byte(rejectReply+"\x00"))
+	}
+
+	header := []byte(s.filter.header + "\x00" + fmt.Sprint(verdict.score) + "\x00")
+	if err := writePacket(s.conn, replyAddHdr, header); err != nil {
+		return err
+	}
+	return writePacket(s.conn, replyCont, nil)
+}
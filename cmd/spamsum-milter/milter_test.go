@@ -0,0 +1,195 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+// fakeMTA drives a milter over one end of a pipe, the way Postfix
+// would.
+type fakeMTA struct {
+	t    *testing.T
+	conn net.Conn
+	done chan error
+}
+
+func startMTA(t *testing.T, f *filter) *fakeMTA {
+	client, server := net.Pipe()
+	mta := &fakeMTA{t, client, make(chan error, 1)}
+	go func() {
+		mta.done <- f.serve(server)
+		server.Close()
+	}()
+	t.Cleanup(func() { client.Close() })
+	return mta
+}
+
+func (m *fakeMTA) send(command byte, data string) {
+	if err := writePacket(m.conn, command, []byte(data)); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *fakeMTA) expect(reply byte) string {
+	command, data, err := readPacket(m.conn)
+	if err != nil {
+		m.t.Fatal(err)
+	} else if command != reply {
+		m.t.Fatalf("Milter replied %q %q, expected %q", command, data, reply)
+	}
+	return string(data)
+}
+
+func (m *fakeMTA) negotiate() uint32 {
+	options := make([]byte, 12)
+	binary.BigEndian.PutUint32(options, 6)
+	binary.BigEndian.PutUint32(options[4:], 0x1ff)
+	binary.BigEndian.PutUint32(options[8:], 0x1fffff)
+	m.send(cmdOptNeg, string(options))
+
+	reply := []byte(m.expect(cmdOptNeg))
+	if binary.BigEndian.Uint32(reply) != 6 || binary.BigEndian.Uint32(reply[4:]) != actionAddHeaders {
+		m.t.Errorf("Unexpected negotiation reply %v", reply)
+	}
+	return binary.BigEndian.Uint32(reply[8:])
+}
+
+// message sends a complete message, and returns the replies to the
+// end of the body.
+func (m *fakeMTA) message(headers [][2]string, body string) (byte, string) {
+	m.send(cmdMacro, "Mi\x00queue-id\x00ABC123\x00")
+	for _, header := range headers {
+		m.send(cmdHeader, header[0]+"\x00 "+header[1]+"\x00")
+		m.expect(replyCont)
+	}
+	m.send(cmdEOH, "")
+	m.expect(replyCont)
+
+	// bodies arrive in chunks
+	for len(body) > 1000 {
+		m.send(cmdBody, body[:1000])
+		m.expect(replyCont)
+		body = body[1000:]
+	}
+	m.send(cmdBody, body)
+	m.expect(replyCont)
+	m.send(cmdEndBody, "")
+
+	command, data, err := readPacket(m.conn)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return command, string(data)
+}
+
+func (m *fakeMTA) quit() {
+	m.send(cmdQuit, "")
+	if err := <-m.done; err != nil {
+		m.t.Error(err)
+	}
+}
+
+func spamText() string {
+	random := rand.New(rand.NewSource(40))
+	words := []string{"cheap", "pills", "offer", "click", "here", "now", "free", "winner", "prize", "account"}
+	var text strings.Builder
+	for i := 0; i < 2000; i++ {
+		text.WriteString(words[random.Intn(len(words))])
+		if i%12 == 11 {
+			text.WriteString("\r\n")
+		} else {
+			text.WriteString(" ")
+		}
+	}
+	return text.String()
+}
+
+func testFilter(t *testing.T, reject uint32) *filter {
+	known := index.New[string, struct{}]()
+	if err := known.Add("campaign", spamsum.HashBytes([]byte(strings.ReplaceAll(spamText(), "\r\n", "\n"))), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	return &filter{known: known, reject: reject, header: "X-Spamsum-Score", normalize: true, maxBody: 1 << 20}
+}
+
+func TestNegotiation(t *testing.T) {
+	mta := startMTA(t, testFilter(t, 0))
+	if protocol := mta.negotiate(); protocol != protoSkipped {
+		t.Errorf("Milter asked to skip %x, expected %x", protocol, protoSkipped)
+	}
+	mta.quit()
+}
+
+func TestScoreHeader(t *testing.T) {
+	mta := startMTA(t, testFilter(t, 0))
+	mta.negotiate()
+
+	headers := [][2]string{{"Subject", "hello"}, {"Content-Type", "text/plain"}}
+	command, data := mta.message(headers, spamText())
+	if command != replyAddHdr || !strings.HasPrefix(data, "X-Spamsum-Score\x00") {
+		t.Fatalf("Milter replied %q %q, expected a header", command, data)
+	}
+	if fields := nulStrings([]byte(data)); fields[1] != "100" {
+		t.Errorf("Known spam scored %s", fields[1])
+	}
+	mta.expect(replyCont)
+
+	command, data = mta.message(headers, "Dear colleague,\r\nThe meeting is at three.\r\n")
+	if command != replyAddHdr || nulStrings([]byte(data))[1] != "0" {
+		t.Errorf("Unrelated message got %q %q", command, data)
+	}
+	mta.expect(replyCont)
+	mta.quit()
+}
+
+func TestReject(t *testing.T) {
+	mta := startMTA(t, testFilter(t, 80))
+	mta.negotiate()
+
+	// the same spam, base64 encoded in a multipart message
+	spam := []byte(strings.ReplaceAll(spamText(), "\r\n", "\n"))
+	body := "--b1\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		lines(encodeBase64(spam), 76) + "--b1--\r\n"
+	headers := [][2]string{{"Content-Type", `multipart/alternative; boundary="b1"`}}
+
+	if command, data := mta.message(headers, body); command != replyCode || !strings.HasPrefix(data, "550 ") {
+		t.Errorf("Milter replied %q %q, expected a rejection", command, data)
+	}
+
+	// the filter should start afresh after an aborted message
+	mta.send(cmdHeader, "Subject\x00 partial\x00")
+	mta.expect(replyCont)
+	mta.send(cmdBody, spamText())
+	mta.expect(replyCont)
+	mta.send(cmdAbort, "")
+
+	if command, _ := mta.message(nil, "Nothing to see here.\r\n"); command != replyAddHdr {
+		t.Errorf("Message after abort got %q", command)
+	}
+	mta.expect(replyCont)
+	mta.quit()
+}
+
+func TestInvalidPackets(t *testing.T) {
+	mta := startMTA(t, testFilter(t, 0))
+	mta.conn.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	if err := <-mta.done; err != errPacketSize {
+		t.Errorf("Oversized packet returned %v", err)
+	}
+
+	mta = startMTA(t, testFilter(t, 0))
+	mta.send('?', "")
+	if err := <-mta.done; err == nil {
+		t.Error("Unknown command should end the session")
+	}
+}
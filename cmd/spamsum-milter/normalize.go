@@ -0,0 +1,77 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// maxDepth limits the nesting of multipart messages normalize follows.
+const maxDepth = 10
+
+// normalize reduces a message body to the decoded contents of its
+// MIME parts, in order, so that the same spam sent with different
+// boundaries, transfer encodings or line endings hashes the same.
+// Parts that cannot be parsed are used as they are.
+func normalize(header textproto.MIMEHeader, body []byte) []byte {
+	var out bytes.Buffer
+	appendPart(&out, header, body, 0)
+	return out.Bytes()
+}
+
+func appendPart(out *bytes.Buffer, header textproto.MIMEHeader, body []byte, depth int) {
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+
+	mediatype, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediatype, "multipart/") &&
+		params["boundary"] != "" && depth < maxDepth {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		parts := 0
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				break
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				break
+			}
+			appendPart(out, part.Header, data, depth+1)
+			parts++
+		}
+		if parts > 0 {
+			return
+		}
+	}
+
+	out.Write(decode(header.Get("Content-Transfer-Encoding"), body))
+}
+
+// decode undoes a Content-Transfer-Encoding, returning body unchanged
+// for identity encodings, or if it is not properly encoded.
+func decode(encoding string, body []byte) []byte {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, bytes.NewReader(body))
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(bytes.NewReader(body))
+	default:
+		return body
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
@@ -0,0 +1,71 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func encodeBase64(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// lines breaks s into CRLF-terminated lines of at most width bytes.
+func lines(s string, width int) string {
+	var out strings.Builder
+	for len(s) > width {
+		out.WriteString(s[:width] + "\r\n")
+		s = s[width:]
+	}
+	out.WriteString(s + "\r\n")
+	return out.String()
+}
+
+func TestNormalize(t *testing.T) {
+	plain := "Hello été\nsecond line\n"
+	header := func(fields ...string) textproto.MIMEHeader {
+		h := make(textproto.MIMEHeader)
+		for i := 0; i < len(fields); i += 2 {
+			h.Set(fields[i], fields[i+1])
+		}
+		return h
+	}
+
+	for _, test := range []struct {
+		header textproto.MIMEHeader
+		body   string
+	}{
+		{header(), "Hello été\r\nsecond line\r\n"},
+		{header("Content-Transfer-Encoding", "quoted-printable"),
+			"Hello =C3=A9t=C3=A9\r\nsecond =\r\nline\r\n"},
+		{header("Content-Transfer-Encoding", "BASE64"),
+			lines(encodeBase64([]byte(plain)), 8)},
+		{header("Content-Type", "multipart/mixed; boundary=xyz"),
+			"preamble\r\n--xyz\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+				lines(encodeBase64([]byte("Hello été\n")), 76) +
+				"--xyz\r\nContent-Type: multipart/alternative; boundary=abc\r\n\r\n" +
+				"--abc\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"second=20=\r\nline\r\n\r\n--abc--\r\n--xyz--\r\n"},
+	} {
+		if normalized := string(normalize(test.header, []byte(test.body))); normalized != plain {
+			t.Errorf("Normalized %q to %q, expected %q", test.body, normalized, plain)
+		}
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "multipart/mixed; boundary=xyz")
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	// neither multipart nor base64: used as it is
+	body := "not *really* base64\n"
+	if normalized := string(normalize(h, []byte(body))); normalized != body {
+		t.Errorf("Normalized %q to %q", body, normalized)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Command spamsumd serves SpamSum hashing, comparison and similarity
+// search over HTTP, with JSON requests and responses.
+//
+//	POST /hash     raw request body             {"digest": "..."}
+//	POST /compare  {"from": "...", "to": "..."} {"score": 0-100}
+//	POST /index    {"entries": [{"id": "...", "digest": "..."}]}
+//	                                            {"added": n}
+//	POST /search   {"digest": "...", "threshold": 0-100}, or
+//	               {"content": "<base64>", "threshold": 0-100}
+//	                                            {"matches": [{"id", "digest", "score"}]}
+//	GET  /healthz                               {"status": "ok", "entries": n}
+//
+// Errors are reported as {"error": "..."} with a 4xx status.  The
+// index is kept in memory; with -snapshot, it is loaded from that file
+// at startup, and written back periodically and on shutdown.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	snapshot := flag.String("snapshot", "", "file to persist the index to")
+	interval := flag.Duration("interval", time.Minute, "time between snapshots")
+	maxBody := flag.Int64("max-body", 64<<20, "maximum request body size in bytes")
+	flag.Parse()
+
+	ix := index.New[string, struct{}]()
+	if *snapshot != "" {
+		loaded, err := loadSnapshot(*snapshot)
+		if err != nil {
+			log.Fatalf("loading snapshot: %v", err)
+		} else if loaded != nil {
+			ix = loaded
+			log.Printf("loaded %d entries from %s", ix.Len(), *snapshot)
+		}
+	}
+
+	s := newServer(ix, *maxBody)
+	httpServer := &http.Server{Addr: *listen, Handler: s.routes()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *snapshot != "" {
+		go func() {
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := s.saveSnapshot(*snapshot); err != nil {
+						log.Printf("writing snapshot: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
+	// ListenAndServe returns as soon as Shutdown starts; requests in
+	// flight may still change the index until Shutdown returns.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdown); err != nil {
+			log.Printf("shutting down: %v", err)
+		}
+	}()
+
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	if *snapshot != "" {
+		if err := s.saveSnapshot(*snapshot); err != nil {
+			log.Fatalf("writing snapshot: %v", err)
+		}
+	}
+}
+
+// loadSnapshot reads the index in path, returning nil if the file does
+// not exist yet.
+func loadSnapshot(path string) (*index.Index[string, struct{}], error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return index.Read(file)
+}
+
+// writeSnapshot writes ix to path.  The snapshot is written to a
+// temporary file first, and renamed over path when complete, so a
+// crash never leaves a partial snapshot behind.
+func writeSnapshot(ix *index.Index[string, struct{}], path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := index.Write(file, ix); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,42 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index")
+
+	if ix, err := loadSnapshot(path); ix != nil || err != nil {
+		t.Fatalf("Loading a missing snapshot returned %v, %v", ix, err)
+	}
+
+	ix := index.New[string, struct{}]()
+	ix.Add("fox", spamsum.HashBytes([]byte("The quick brown fox jumps over the lazy dog")), struct{}{})
+	if err := writeSnapshot(ix, path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum, _, ok := loaded.Get("fox"); !ok || sum.String() != "3:FJKKIUKact:FHIGi" {
+		t.Errorf("Loaded snapshot holds %v", sum)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Temporary files left behind: %v", files)
+	}
+}
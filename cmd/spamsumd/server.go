@@ -0,0 +1,271 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+// server holds the state shared by all handlers.  indexMu serializes
+// index requests, so that their IDs can be checked before any entry is
+// added.  changes counts the additions to the index, saved the number
+// of changes covered by the last snapshot.
+type server struct {
+	index   *index.Index[string, struct{}]
+	indexMu sync.Mutex
+	maxBody int64
+
+	changes atomic.Int64
+	saveMu  sync.Mutex
+	saved   int64
+}
+
+func newServer(ix *index.Index[string, struct{}], maxBody int64) *server {
+	return &server{index: ix, maxBody: maxBody}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hash", only(http.MethodPost, s.handleHash))
+	mux.HandleFunc("/compare", only(http.MethodPost, s.handleCompare))
+	mux.HandleFunc("/index", only(http.MethodPost, s.handleIndex))
+	mux.HandleFunc("/search", only(http.MethodPost, s.handleSearch))
+	mux.HandleFunc("/healthz", only(http.MethodGet, s.handleHealth))
+	return mux
+}
+
+// only restricts handler to requests using method.
+func only(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// saveSnapshot writes the index to path, unless nothing changed since
+// the last snapshot.
+func (s *server) saveSnapshot(path string) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	changes := s.changes.Load()
+	if changes == s.saved {
+		return nil
+	}
+	if err := writeSnapshot(s.index, path); err != nil {
+		return err
+	}
+	s.saved = changes
+	return nil
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{err.Error()})
+}
+
+// readError reports an error reading the request body, which is
+// either too large or malformed.
+func readError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	} else {
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+func (s *server) decode(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		readError(w, err)
+		return false
+	}
+	return true
+}
+
+func parseDigest(digest string) (*spamsum.SpamSum, error) {
+	sum := new(spamsum.SpamSum)
+	if _, err := fmt.Sscan(digest, sum); err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %v", digest, err)
+	}
+	return sum, nil
+}
+
+type hashResponse struct {
+	Digest string `json:"digest"`
+}
+
+func (s *server) handleHash(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil {
+		readError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hashResponse{spamsum.HashBytes(content).String()})
+}
+
+type compareRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type compareResponse struct {
+	Score uint32 `json:"score"`
+}
+
+func (s *server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	var request compareRequest
+	if !s.decode(w, r, &request) {
+		return
+	}
+
+	from, err := parseDigest(request.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseDigest(request.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, compareResponse{from.Compare(*to)})
+}
+
+type indexEntry struct {
+	ID     string `json:"id"`
+	Digest string `json:"digest"`
+}
+
+type indexRequest struct {
+	Entries []indexEntry `json:"entries"`
+}
+
+type indexResponse struct {
+	Added int `json:"added"`
+}
+
+// handleIndex adds entries to the index.  All entries are checked
+// before any are added; an ID that is already in use, or that occurs
+// twice in the request, fails the request as a whole.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	var request indexRequest
+	if !s.decode(w, r, &request) {
+		return
+	}
+
+	sums := make([]*spamsum.SpamSum, len(request.Entries))
+	for i, entry := range request.Entries {
+		if entry.ID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("entry without id"))
+			return
+		}
+		sum, err := parseDigest(entry.Digest)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sums[i] = sum
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	seen := make(map[string]bool, len(request.Entries))
+	for _, entry := range request.Entries {
+		if _, _, found := s.index.Get(entry.ID); found || seen[entry.ID] {
+			writeError(w, http.StatusConflict, fmt.Errorf("%s: %v", entry.ID, index.ErrDuplicateID))
+			return
+		}
+		seen[entry.ID] = true
+	}
+
+	for i, entry := range request.Entries {
+		if err := s.index.Add(entry.ID, sums[i], struct{}{}); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.changes.Add(1)
+	}
+	writeJSON(w, http.StatusOK, indexResponse{len(request.Entries)})
+}
+
+type searchRequest struct {
+	Digest    string `json:"digest"`
+	Content   []byte `json:"content"`
+	Threshold uint32 `json:"threshold"`
+}
+
+type searchMatch struct {
+	ID     string `json:"id"`
+	Digest string `json:"digest"`
+	Score  uint32 `json:"score"`
+}
+
+type searchResponse struct {
+	Matches []searchMatch `json:"matches"`
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var request searchRequest
+	if !s.decode(w, r, &request) {
+		return
+	}
+
+	var query *spamsum.SpamSum
+	if request.Content != nil {
+		if request.Digest != "" {
+			writeError(w, http.StatusBadRequest, errors.New("both digest and content given"))
+			return
+		}
+		query = spamsum.HashBytes(request.Content)
+	} else {
+		var err error
+		if query, err = parseDigest(request.Digest); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	response := searchResponse{make([]searchMatch, 0)}
+	for _, match := range s.index.Search(query, request.Threshold) {
+		response.Matches = append(response.Matches,
+			searchMatch{match.Key, match.Sum.String(), match.Score})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Entries int    `json:"entries"`
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{"ok", s.index.Len()})
+}
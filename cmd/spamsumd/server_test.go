@@ -0,0 +1,193 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+	"github.com/michielbuddingh/spamsum/index"
+)
+
+func testServer(t *testing.T) (*server, *httptest.Server) {
+	s := newServer(index.New[string, struct{}](), 1<<20)
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// post sends body to path, and decodes the response into response.
+// Returns the status code.
+func post(t *testing.T, ts *httptest.Server, path string, body interface{}, response interface{}) int {
+	var data []byte
+	if raw, ok := body.([]byte); ok {
+		data = raw
+	} else {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func testContents(t *testing.T) ([]byte, []byte) {
+	contents, err := os.ReadFile(filepath.Join("..", "..", "testdata", "LAND.MAP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := append([]byte(nil), contents...)
+	copy(modified[len(modified)/2:], "a change in the middle of the file")
+	return contents, modified
+}
+
+func TestHashAndCompare(t *testing.T) {
+	_, ts := testServer(t)
+	contents, modified := testContents(t)
+
+	var first, second hashResponse
+	if status := post(t, ts, "/hash", contents, &first); status != http.StatusOK {
+		t.Fatalf("Status %d", status)
+	}
+	if first.Digest != spamsum.HashBytes(contents).String() {
+		t.Errorf("Hash returned %s", first.Digest)
+	}
+	post(t, ts, "/hash", modified, &second)
+
+	var compared compareResponse
+	post(t, ts, "/compare", compareRequest{first.Digest, second.Digest}, &compared)
+	expected, _ := parseDigest(first.Digest)
+	other, _ := parseDigest(second.Digest)
+	if compared.Score != expected.Compare(*other) || compared.Score == 0 {
+		t.Errorf("Compare returned %d, expected %d", compared.Score, expected.Compare(*other))
+	}
+
+	var failed errorResponse
+	if status := post(t, ts, "/compare", compareRequest{"bogus", first.Digest}, &failed); status != http.StatusBadRequest || failed.Error == "" {
+		t.Errorf("Comparing an invalid digest returned status %d, %q", status, failed.Error)
+	}
+}
+
+func TestIndexAndSearch(t *testing.T) {
+	s, ts := testServer(t)
+	contents, modified := testContents(t)
+
+	entries := indexRequest{[]indexEntry{
+		{"original", spamsum.HashBytes(contents).String()},
+		{"fox", spamsum.HashBytes([]byte("The quick brown fox jumps over the lazy dog")).String()},
+	}}
+	var added indexResponse
+	if status := post(t, ts, "/index", entries, &added); status != http.StatusOK || added.Added != 2 {
+		t.Fatalf("Index returned status %d, added %d", status, added.Added)
+	}
+	fresh := indexEntry{"fresh", entries.Entries[1].Digest}
+	for _, conflicting := range []indexRequest{
+		entries,
+		{[]indexEntry{fresh, entries.Entries[0]}},
+		{[]indexEntry{fresh, fresh}},
+	} {
+		if status := post(t, ts, "/index", conflicting, nil); status != http.StatusConflict {
+			t.Errorf("Adding duplicate IDs returned status %d", status)
+		}
+		if s.index.Len() != 2 {
+			t.Errorf("Index holds %d entries after a conflict", s.index.Len())
+		}
+	}
+
+	var byContent, byDigest searchResponse
+	post(t, ts, "/search", searchRequest{Content: modified, Threshold: 50}, &byContent)
+	if len(byContent.Matches) != 1 || byContent.Matches[0].ID != "original" {
+		t.Errorf("Search by content found %v", byContent.Matches)
+	}
+	post(t, ts, "/search", searchRequest{Digest: spamsum.HashBytes(modified).String(), Threshold: 50}, &byDigest)
+	if len(byDigest.Matches) != 1 || byDigest.Matches[0] != byContent.Matches[0] {
+		t.Errorf("Search by digest found %v", byDigest.Matches)
+	}
+
+	var none searchResponse
+	post(t, ts, "/search", searchRequest{Digest: byDigest.Matches[0].Digest, Threshold: 101}, &none)
+	if none.Matches == nil || len(none.Matches) != 0 {
+		t.Errorf("Search above the maximum score found %v", none.Matches)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	s, ts := testServer(t)
+	s.maxBody = 100
+
+	if status := post(t, ts, "/hash", bytes.Repeat([]byte("x"), 101), nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized hash request returned status %d", status)
+	}
+	if status := post(t, ts, "/search", searchRequest{Content: bytes.Repeat([]byte("x"), 100)}, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized search request returned status %d", status)
+	}
+	if status := post(t, ts, "/compare", []byte(`{"from": 1}`), nil); status != http.StatusBadRequest {
+		t.Errorf("Malformed request returned status %d", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /hash returned status %d", resp.StatusCode)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	_, ts := testServer(t)
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var health healthResponse
+	json.NewDecoder(resp.Body).Decode(&health)
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" {
+		t.Errorf("Health check returned status %d, %v", resp.StatusCode, health)
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	s, ts := testServer(t)
+	path := filepath.Join(t.TempDir(), "index")
+
+	if err := s.saveSnapshot(path); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Unchanged index should not be written")
+	}
+
+	post(t, ts, "/index", indexRequest{[]indexEntry{{"fox", "3:FJKKIUKact:FHIGi"}}}, nil)
+	if err := s.saveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(data), `3:FJKKIUKact:FHIGi "fox"`) {
+		t.Errorf("Snapshot does not contain the entry:\n%s", data)
+	}
+}
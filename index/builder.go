@@ -0,0 +1,187 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// A Builder collects SpamSums, and writes them as an index file that
+// Open can read.
+type Builder struct {
+	index *Index[string, struct{}]
+}
+
+// NewBuilder returns an empty Builder for SpamSums made with the
+// default parameters.
+func NewBuilder() *Builder {
+	return &Builder{New[string, struct{}]()}
+}
+
+// NewBuilderWithParams returns an empty Builder for SpamSums made with
+// params.
+func NewBuilderWithParams(params spamsum.Params) *Builder {
+	return &Builder{NewWithParams[string, struct{}](params)}
+}
+
+// Add stores sum under id, returning the same errors as Index.Add.
+func (b *Builder) Add(id string, sum *spamsum.SpamSum) error {
+	return b.index.Add(id, sum, struct{}{})
+}
+
+// Len returns the number of SpamSums added to the Builder.
+func (b *Builder) Len() int {
+	return b.index.Len()
+}
+
+// sections encodes the contents of the Builder.
+func (b *Builder) sections() ([sectionCount][]byte, error) {
+	ix := b.index
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var sections [sectionCount][]byte
+	le := binary.LittleEndian
+
+	ids := make([]string, 0, len(ix.entries))
+	for id := range ix.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	numbers := make(map[string]uint32, len(ids))
+	for n, id := range ids {
+		numbers[id] = uint32(n)
+		encoded, err := ix.entries[id].sum.MarshalBinary()
+		if err != nil {
+			return sections, err
+		}
+		sections[sectionEntries] = le.AppendUint32(sections[sectionEntries], uint32(len(sections[sectionIDs])))
+		sections[sectionEntries] = le.AppendUint32(sections[sectionEntries], uint32(len(id)))
+		sections[sectionEntries] = append(sections[sectionEntries], encoded...)
+		sections[sectionIDs] = append(sections[sectionIDs], id...)
+	}
+
+	keys := make([]key, 0, len(ix.postings))
+	for k := range ix.postings {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].blocksize != keys[j].blocksize {
+			return keys[i].blocksize < keys[j].blocksize
+		}
+		return keys[i].gram < keys[j].gram
+	})
+
+	postings := 0
+	for i, k := range keys {
+		if i == 0 || keys[i-1].blocksize != k.blocksize {
+			sections[sectionBuckets] = le.AppendUint32(sections[sectionBuckets], k.blocksize)
+			sections[sectionBuckets] = le.AppendUint32(sections[sectionBuckets], uint32(i))
+			sections[sectionBuckets] = le.AppendUint32(sections[sectionBuckets], 0)
+		}
+		bucket := sections[sectionBuckets][len(sections[sectionBuckets])-bucketSize:]
+		le.PutUint32(bucket[8:], le.Uint32(bucket[8:])+1)
+
+		entries := make([]uint32, 0, len(ix.postings[k]))
+		for _, n := range ix.postings[k] {
+			// nothing is ever removed from a Builder's index
+			entries = append(entries, numbers[ix.numbered[n]])
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+
+		sections[sectionKeys] = append(sections[sectionKeys], k.gram...)
+		sections[sectionKeys] = le.AppendUint32(sections[sectionKeys], uint32(postings))
+		sections[sectionKeys] = le.AppendUint32(sections[sectionKeys], uint32(len(entries)))
+		for _, n := range entries {
+			sections[sectionPostings] = le.AppendUint32(sections[sectionPostings], n)
+		}
+		postings += len(entries)
+	}
+
+	return sections, nil
+}
+
+// WriteTo writes the index file to w.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	sections, err := b.sections()
+	if err != nil {
+		return 0, err
+	}
+
+	le := binary.LittleEndian
+	params := b.index.params
+	header := make([]byte, headerSize)
+	copy(header, diskMagic)
+	le.PutUint32(header[8:], diskVersion)
+	le.PutUint32(header[12:], uint32(params.SignatureLength))
+	le.PutUint32(header[16:], uint32(params.Window))
+	le.PutUint32(header[20:], params.MinBlockSize)
+	le.PutUint32(header[24:], uint32(b.index.Len()))
+
+	offset := uint64(headerSize)
+	for i, section := range sections {
+		entry := header[sectionTable+i*sectionSize:]
+		le.PutUint64(entry, offset)
+		le.PutUint64(entry[8:], uint64(len(section)))
+		le.PutUint32(entry[16:], crc32.Checksum(section, castagnoli))
+		offset += uint64(len(section))
+	}
+	le.PutUint32(header[headerCRC:], crc32.Checksum(header[:headerCRC], castagnoli))
+
+	var written int64
+	writer := bufio.NewWriter(w)
+	for _, data := range append([][]byte{header}, sections[:]...) {
+		n, err := writer.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, writer.Flush()
+}
+
+// WriteFile writes the index file to path.  It is written to a
+// temporary file in the same directory first, which replaces path
+// once it is complete and synced, so readers never see a partially
+// written index.
+func (b *Builder) WriteFile(path string) error {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := b.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable, where directories can be synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
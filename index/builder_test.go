@@ -0,0 +1,110 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+func TestBuilderWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index")
+	sums := corpus(10)
+
+	first := NewBuilder()
+	first.Add("first", sums[0])
+	if err := first.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replacing the file leaves the open index intact
+	second := NewBuilder()
+	for _, sum := range sums[1:] {
+		second.Add(sum.String(), sum)
+	}
+	if err := second.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := opened.Get("first"); !ok || opened.Len() != 1 {
+		t.Error("Replacing the file changed an open index")
+	}
+	opened.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != second.Len() {
+		t.Errorf("Replaced index holds %d sums, expected %d", reopened.Len(), second.Len())
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Temporary files left behind: %v", files)
+	}
+}
+
+func TestBuilderDeterministic(t *testing.T) {
+	sums := corpus(10)
+	var outputs [2]bytes.Buffer
+	for i := range outputs {
+		builder := NewBuilder()
+		// add in a different order each time
+		for j := range sums {
+			sum := sums[j]
+			if i == 1 {
+				sum = sums[len(sums)-1-j]
+			}
+			builder.Add(sum.String(), sum)
+		}
+		if _, err := builder.WriteTo(&outputs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(outputs[0].Bytes(), outputs[1].Bytes()) {
+		t.Error("Equal builders produce different files")
+	}
+}
+
+func TestBuilderParams(t *testing.T) {
+	params := spamsum.Params{SignatureLength: 128, Window: 5, MinBlockSize: 3}
+	hasher, _ := spamsum.NewHasher(params)
+	builder := NewBuilderWithParams(params)
+
+	input := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 200)
+	sum := hasher.HashBytes(input)
+	if err := builder.Add("fox", sum); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Add("default", spamsum.HashBytes(input)); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Adding a sum with other parameters returned %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index")
+	builder.WriteFile(path)
+	ix, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	parsed, _ := hasher.Parse(sum.String())
+	if ix.Params() != params {
+		t.Errorf("Opened index has parameters %v", ix.Params())
+	}
+	if matches := ix.Search(parsed, 100); len(matches) != 1 || matches[0].Key != "fox" {
+		t.Errorf("Search with custom parameters found %v", matches)
+	}
+}
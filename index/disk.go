@@ -0,0 +1,323 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iter"
+	"os"
+	"sort"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// The on-disk format consists of a header followed by five sections.
+// All integers are little-endian.
+//
+//	header    magic, version, parameters, number of SpamSums, and the
+//	          offset, length and CRC-32 of every section, followed by
+//	          the CRC-32 of the header itself
+//	buckets   per block size: the block size, the first key and the
+//	          number of keys; sorted by block size
+//	keys      per gram: the gram, the first posting and the number of
+//	          postings; sorted by gram within a bucket
+//	postings  entry numbers
+//	entries   per SpamSum: offset and length of its ID, and its binary
+//	          encoding; sorted by ID
+//	ids       all IDs, concatenated
+const (
+	diskMagic   = "spamsumx"
+	diskVersion = 2
+)
+
+const (
+	sectionBuckets = iota
+	sectionKeys
+	sectionPostings
+	sectionEntries
+	sectionIDs
+	sectionCount
+
+	sectionTable = 32
+	sectionSize  = 24
+	headerCRC    = sectionTable + sectionCount*sectionSize
+	headerSize   = headerCRC + 8
+
+	bucketSize  = 12
+	postingSize = 4
+)
+
+// ErrCorruptIndex is returned by Open for files that are truncated,
+// fail a checksum, or are otherwise inconsistent.
+var ErrCorruptIndex = errors.New("Index file is corrupt")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// A DiskIndex is a read-only Index stored in a file written by a
+// Builder.  The file is mapped into memory where the platform allows
+// it, rather than loaded onto the heap.  Open reads the whole file
+// once to verify it, so opening takes time proportional to its size;
+// after that, a query only reads the parts it touches.  A DiskIndex is
+// safe for concurrent use, but not after Close.
+type DiskIndex struct {
+	data     []byte
+	unmap    func() error
+	params   spamsum.Params
+	hasher   *spamsum.Hasher
+	entries  int
+	sections [sectionCount][]byte
+
+	keySize, entrySize int
+}
+
+// Open opens an index file written by a Builder.  The whole file is
+// checked against its checksums; a truncated or damaged file results
+// in ErrCorruptIndex.
+func Open(path string) (*DiskIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mapFile(file, int(stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	ix, err := parseDisk(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	ix.unmap = unmap
+	return ix, nil
+}
+
+func corrupt(reason string) error {
+	return fmt.Errorf("%w: %s", ErrCorruptIndex, reason)
+}
+
+func parseDisk(data []byte) (*DiskIndex, error) {
+	if len(data) < headerSize {
+		return nil, corrupt("truncated header")
+	} else if string(data[:8]) != diskMagic {
+		return nil, errors.New("Not a spamsum index file")
+	} else if crc32.Checksum(data[:headerCRC], castagnoli) != binary.LittleEndian.Uint32(data[headerCRC:]) {
+		return nil, corrupt("header checksum mismatch")
+	} else if version := binary.LittleEndian.Uint32(data[8:]); version != diskVersion {
+		return nil, fmt.Errorf("Unsupported index file version %d", version)
+	}
+
+	ix := &DiskIndex{data: data}
+	ix.params = spamsum.Params{
+		SignatureLength: int(binary.LittleEndian.Uint32(data[12:])),
+		Window:          int(binary.LittleEndian.Uint32(data[16:])),
+		MinBlockSize:    binary.LittleEndian.Uint32(data[20:]),
+	}
+	hasher, err := spamsum.NewHasher(ix.params)
+	if err != nil {
+		return nil, err
+	}
+	ix.hasher = hasher
+	ix.entries = int(binary.LittleEndian.Uint32(data[24:]))
+	ix.keySize = ix.params.Window + 8
+	ix.entrySize = 8 + hasher.NewHash(ix.params.MinBlockSize).Size()
+
+	for i := range ix.sections {
+		entry := data[sectionTable+i*sectionSize:]
+		offset := binary.LittleEndian.Uint64(entry)
+		length := binary.LittleEndian.Uint64(entry[8:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, corrupt("section beyond end of file")
+		}
+		ix.sections[i] = data[offset : offset+length]
+		if crc32.Checksum(ix.sections[i], castagnoli) != binary.LittleEndian.Uint32(entry[16:]) {
+			return nil, corrupt("section checksum mismatch")
+		}
+	}
+
+	if err := ix.check(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// check verifies that all references between sections are in range,
+// so that no query can read beyond a section.
+func (ix *DiskIndex) check() error {
+	buckets, keys := ix.sections[sectionBuckets], ix.sections[sectionKeys]
+	postings, ids := ix.sections[sectionPostings], ix.sections[sectionIDs]
+	if len(buckets)%bucketSize != 0 || len(keys)%ix.keySize != 0 ||
+		len(postings)%postingSize != 0 ||
+		len(ix.sections[sectionEntries]) != ix.entries*ix.entrySize {
+		return corrupt("section sizes inconsistent")
+	}
+
+	numKeys, numPostings := len(keys)/ix.keySize, len(postings)/postingSize
+	for i := 0; i < len(buckets); i += bucketSize {
+		first := uint64(binary.LittleEndian.Uint32(buckets[i+4:]))
+		count := uint64(binary.LittleEndian.Uint32(buckets[i+8:]))
+		if first+count > uint64(numKeys) {
+			return corrupt("bucket refers to missing keys")
+		}
+	}
+	for i := 0; i < len(keys); i += ix.keySize {
+		first := uint64(binary.LittleEndian.Uint32(keys[i+ix.params.Window:]))
+		count := uint64(binary.LittleEndian.Uint32(keys[i+ix.params.Window+4:]))
+		if first+count > uint64(numPostings) {
+			return corrupt("key refers to missing postings")
+		}
+	}
+	for i := 0; i < len(postings); i += postingSize {
+		if binary.LittleEndian.Uint32(postings[i:]) >= uint32(ix.entries) {
+			return corrupt("posting refers to missing entry")
+		}
+	}
+	for n := 0; n < ix.entries; n++ {
+		record := ix.entry(n)
+		offset := uint64(binary.LittleEndian.Uint32(record))
+		length := uint64(binary.LittleEndian.Uint32(record[4:]))
+		if offset+length > uint64(len(ids)) {
+			return corrupt("entry refers to missing ID")
+		}
+	}
+	return nil
+}
+
+// Close releases the file.  The DiskIndex must not be used afterwards.
+func (ix *DiskIndex) Close() error {
+	ix.data = nil
+	ix.sections = [sectionCount][]byte{}
+	return ix.unmap()
+}
+
+// Params returns the parameters of the SpamSums in the index.
+func (ix *DiskIndex) Params() spamsum.Params {
+	return ix.params
+}
+
+// Len returns the number of SpamSums in the index.
+func (ix *DiskIndex) Len() int {
+	return ix.entries
+}
+
+func (ix *DiskIndex) entry(n int) []byte {
+	return ix.sections[sectionEntries][n*ix.entrySize : (n+1)*ix.entrySize]
+}
+
+func (ix *DiskIndex) id(n int) string {
+	record := ix.entry(n)
+	offset := binary.LittleEndian.Uint32(record)
+	length := binary.LittleEndian.Uint32(record[4:])
+	return string(ix.sections[sectionIDs][offset : offset+length])
+}
+
+func (ix *DiskIndex) sum(n int) (*spamsum.SpamSum, error) {
+	return ix.hasher.DecodeSum(ix.entry(n)[8:])
+}
+
+// Get returns the SpamSum stored under id.
+func (ix *DiskIndex) Get(id string) (*spamsum.SpamSum, bool) {
+	n := sort.Search(ix.entries, func(n int) bool {
+		return ix.id(n) >= id
+	})
+	if n == ix.entries || ix.id(n) != id {
+		return nil, false
+	}
+	sum, err := ix.sum(n)
+	return sum, err == nil
+}
+
+// postings returns the posting list of k, in the on-disk encoding.
+func (ix *DiskIndex) postings(k key) []byte {
+	buckets := ix.sections[sectionBuckets]
+	numBuckets := len(buckets) / bucketSize
+	b := sort.Search(numBuckets, func(b int) bool {
+		return binary.LittleEndian.Uint32(buckets[b*bucketSize:]) >= k.blocksize
+	})
+	if b == numBuckets || binary.LittleEndian.Uint32(buckets[b*bucketSize:]) != k.blocksize {
+		return nil
+	}
+
+	first := int(binary.LittleEndian.Uint32(buckets[b*bucketSize+4:]))
+	count := int(binary.LittleEndian.Uint32(buckets[b*bucketSize+8:]))
+	keys := ix.sections[sectionKeys][first*ix.keySize : (first+count)*ix.keySize]
+	gram := []byte(k.gram)
+	window := ix.params.Window
+
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(keys[i*ix.keySize:i*ix.keySize+window], gram) >= 0
+	})
+	if i == count || !bytes.Equal(keys[i*ix.keySize:i*ix.keySize+window], gram) {
+		return nil
+	}
+
+	record := keys[i*ix.keySize+window:]
+	start := int(binary.LittleEndian.Uint32(record))
+	length := int(binary.LittleEndian.Uint32(record[4:]))
+	return ix.sections[sectionPostings][start*postingSize : (start+length)*postingSize]
+}
+
+// All returns an iterator over the SpamSums in the index, in order of
+// their IDs.
+func (ix *DiskIndex) All() iter.Seq[Entry[string, struct{}]] {
+	return func(yield func(Entry[string, struct{}]) bool) {
+		for n := 0; n < ix.entries; n++ {
+			sum, err := ix.sum(n)
+			if err != nil {
+				continue
+			}
+			if !yield(Entry[string, struct{}]{Key: ix.id(n), Sum: sum}) {
+				return
+			}
+		}
+	}
+}
+
+// Search returns all stored SpamSums scoring at least threshold
+// against query, and more than 0, best first.  Matches with equal
+// scores are ordered by ID.
+func (ix *DiskIndex) Search(query *spamsum.SpamSum, threshold uint32) []Match[string, struct{}] {
+	matches := make([]Match[string, struct{}], 0)
+	if query.Params() != ix.params {
+		return matches
+	}
+
+	candidates := make(map[int]bool)
+	for k := range keysOf(query, ix.params.Window) {
+		postings := ix.postings(k)
+		for i := 0; i < len(postings); i += postingSize {
+			candidates[int(binary.LittleEndian.Uint32(postings[i:]))] = true
+		}
+	}
+	// entries are sorted by ID
+	numbers := make([]int, 0, len(candidates))
+	for n := range candidates {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		sum, err := ix.sum(n)
+		if err != nil {
+			continue
+		}
+		if score, ok := query.CompareAtLeast(*sum, max(threshold, 1)); ok {
+			matches = append(matches, Match[string, struct{}]{Entry[string, struct{}]{Key: ix.id(n), Sum: sum}, score})
+		}
+	}
+
+	sortMatches(matches)
+	return matches
+}
@@ -0,0 +1,132 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// writeDisk writes the sums to an index file, and returns its path,
+// along with an in-memory Index holding the same sums.
+func writeDisk(t *testing.T, sums []*spamsum.SpamSum) (string, *Index[string, struct{}]) {
+	builder := NewBuilder()
+	memory := New[string, struct{}]()
+	for i, sum := range sums {
+		id := fmt.Sprintf("sum %02d", i)
+		if err := builder.Add(id, sum); err != nil {
+			t.Fatal(err)
+		}
+		memory.Add(id, sum, struct{}{})
+	}
+
+	path := filepath.Join(t.TempDir(), "index")
+	if err := builder.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path, memory
+}
+
+func TestDiskIndexSearch(t *testing.T) {
+	sums := corpus(40)
+	path, memory := writeDisk(t, sums)
+
+	ix, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	if ix.Len() != len(sums) || ix.Params() != spamsum.DefaultParams {
+		t.Errorf("Opened index holds %d sums with %v", ix.Len(), ix.Params())
+	}
+
+	for _, query := range sums {
+		for _, threshold := range []uint32{0, 50, 90} {
+			expected, actual := memory.Search(query, threshold), ix.Search(query, threshold)
+			if len(expected) != len(actual) {
+				t.Fatalf("Disk index found %d matches, expected %d", len(actual), len(expected))
+			}
+			for i := range expected {
+				if expected[i].Key != actual[i].Key || expected[i].Score != actual[i].Score ||
+					expected[i].Sum.String() != actual[i].Sum.String() {
+					t.Errorf("Disk index found %v, expected %v", actual[i], expected[i])
+				}
+			}
+		}
+	}
+
+	for i, sum := range sums {
+		if stored, ok := ix.Get(fmt.Sprintf("sum %02d", i)); !ok || stored.String() != sum.String() {
+			t.Errorf("Get returned %v, %v; expected %v", stored, ok, sum)
+		}
+	}
+	if _, ok := ix.Get("missing"); ok {
+		t.Error("Get found a missing ID")
+	}
+}
+
+func TestDiskIndexEmpty(t *testing.T) {
+	path, _ := writeDisk(t, nil)
+	ix, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	query := spamsum.HashBytes([]byte("The quick brown fox jumps over the lazy dog"))
+	if ix.Len() != 0 || len(ix.Search(query, 0)) != 0 {
+		t.Error("Empty index should find nothing")
+	}
+}
+
+func TestDiskIndexCorruption(t *testing.T) {
+	path, _ := writeDisk(t, corpus(10))
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	damaged := filepath.Join(t.TempDir(), "damaged")
+	check := func(description string, data []byte) {
+		if err := os.WriteFile(damaged, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if ix, err := Open(damaged); err == nil {
+			ix.Close()
+			t.Errorf("Opening an index with %s should fail", description)
+		} else if !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("Opening an index with %s returned %v", description, err)
+		}
+	}
+
+	for _, length := range []int{0, headerSize - 1, headerSize, len(original) / 2, len(original) - 1} {
+		check(fmt.Sprintf("%d of %d bytes", length, len(original)), original[:length])
+	}
+
+	// one flipped bit anywhere past the magic
+	for offset := 8; offset < len(original); offset += 97 {
+		data := append([]byte(nil), original...)
+		data[offset] ^= 0x10
+		check(fmt.Sprintf("a flipped bit at %d", offset), data)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("Opening a missing file returned %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	os.WriteFile(path, []byte("spamsum-index 64 7 3 0\n"+string(make([]byte, headerSize))), 0644)
+	if _, err := Open(path); err == nil || errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("Opening a text snapshot returned %v", err)
+	}
+}
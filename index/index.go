@@ -0,0 +1,348 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package index finds the SpamSums most similar to a query among a
+// large number of stored ones, without comparing the query to every
+// one of them.
+//
+// Compare only gives a non-zero score to digest halves of the same
+// block size that share a substring of Window characters (a gram).
+// The Index keeps, for every block size and gram, a posting list of
+// the stored SpamSums containing it, and only compares the query to
+// SpamSums found in the posting lists of its own grams.
+package index
+
+import (
+	"errors"
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// ErrDuplicateID is returned when adding a SpamSum under a key that
+// is already in use.
+var ErrDuplicateID = errors.New("ID already in index")
+
+// ErrNotFound is returned when removing or replacing a key that is
+// not in the index.
+var ErrNotFound = errors.New("ID not in index")
+
+// An Entry is a SpamSum stored in an index, with its key and the
+// value stored alongside it.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+	Sum   *spamsum.SpamSum
+}
+
+// A Match is a stored entry found by Search, with its score against
+// the query.
+type Match[K comparable, V any] struct {
+	Entry[K, V]
+	Score uint32
+}
+
+// key identifies a posting list: a gram occurring in a digest half
+// hashed with blocksize.
+type key struct {
+	blocksize uint32
+	gram      string
+}
+
+// entry is an Entry as stored in an Index, with its entry number.
+type entry[V any] struct {
+	sum    *spamsum.SpamSum
+	value  V
+	number int
+}
+
+// An Index stores SpamSums under keys of type K, each with a value of
+// type V, for instance a message ID and the time it was received.
+// Indexes that need no value use struct{}.
+//
+// An Index is safe for concurrent use.  Every search sees the Index
+// either before or after any change made concurrently, never halfway.
+//
+// Posting lists refer to SpamSums by entry number.  Removing a SpamSum
+// only forgets its entry number, leaving a tombstone in every posting
+// list that holds it; Compact clears them out.
+type Index[K comparable, V any] struct {
+	// mu guards all fields for readers; writeMu is held by all
+	// writers, so that Compact can rebuild the posting lists
+	// without keeping readers out.
+	mu      sync.RWMutex
+	writeMu sync.Mutex
+
+	params   spamsum.Params
+	entries  map[K]entry[V]
+	numbered map[int]K
+	postings map[key][]int
+
+	next, tombstones int
+}
+
+// New returns an empty Index for SpamSums made with the default
+// parameters.
+func New[K comparable, V any]() *Index[K, V] {
+	return NewWithParams[K, V](spamsum.DefaultParams)
+}
+
+// NewWithParams returns an empty Index for SpamSums made with params.
+func NewWithParams[K comparable, V any](params spamsum.Params) *Index[K, V] {
+	return &Index[K, V]{
+		params:   params,
+		entries:  make(map[K]entry[V]),
+		numbered: make(map[int]K),
+		postings: make(map[key][]int),
+	}
+}
+
+// Params returns the parameters of the SpamSums in the Index.
+func (ix *Index[K, V]) Params() spamsum.Params {
+	return ix.params
+}
+
+// keys returns the distinct posting list keys of sum.
+func (ix *Index[K, V]) keys(sum *spamsum.SpamSum) map[key]bool {
+	return keysOf(sum, ix.params.Window)
+}
+
+// keysOf returns the distinct posting list keys of sum, for grams of
+// window characters.
+func keysOf(sum *spamsum.SpamSum, window int) map[key]bool {
+	parts := strings.SplitN(sum.String(), ":", 3)
+	blocksize := uint32(sum.BlockSize())
+
+	keys := make(map[key]bool)
+	for i, half := range parts[1:] {
+		for j := 0; j+window <= len(half); j++ {
+			keys[key{blocksize << uint(i), half[j : j+window]}] = true
+		}
+	}
+	return keys
+}
+
+// sortMatches orders matches best first, keeping the order of matches
+// with equal scores.
+func sortMatches[K comparable, V any](matches []Match[K, V]) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+}
+
+// Add stores sum under k, along with value.  Returns ErrDuplicateID
+// if k is in use, and spamsum.ErrParamsMismatch if sum was made with
+// other parameters than the Index.
+func (ix *Index[K, V]) Add(k K, sum *spamsum.SpamSum, value V) error {
+	if sum.Params() != ix.params {
+		return spamsum.ErrParamsMismatch
+	}
+
+	ix.writeMu.Lock()
+	defer ix.writeMu.Unlock()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if _, ok := ix.entries[k]; ok {
+		return ErrDuplicateID
+	}
+	ix.add(k, sum, value)
+	return nil
+}
+
+func (ix *Index[K, V]) add(k K, sum *spamsum.SpamSum, value V) {
+	n := ix.next
+	ix.next++
+
+	ix.entries[k] = entry[V]{sum, value, n}
+	ix.numbered[n] = k
+	for pk := range ix.keys(sum) {
+		ix.postings[pk] = append(ix.postings[pk], n)
+	}
+}
+
+func (ix *Index[K, V]) remove(k K) {
+	delete(ix.numbered, ix.entries[k].number)
+	delete(ix.entries, k)
+	ix.tombstones++
+}
+
+// Remove deletes the SpamSum stored under k.  Returns ErrNotFound if
+// there is none.
+func (ix *Index[K, V]) Remove(k K) error {
+	ix.writeMu.Lock()
+	defer ix.writeMu.Unlock()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if _, ok := ix.entries[k]; !ok {
+		return ErrNotFound
+	}
+	ix.remove(k)
+	return nil
+}
+
+// Replace stores sum and value under k, in place of the SpamSum
+// stored there.  Returns ErrNotFound if there is none, and
+// spamsum.ErrParamsMismatch if sum was made with other parameters
+// than the Index.
+func (ix *Index[K, V]) Replace(k K, sum *spamsum.SpamSum, value V) error {
+	if sum.Params() != ix.params {
+		return spamsum.ErrParamsMismatch
+	}
+
+	ix.writeMu.Lock()
+	defer ix.writeMu.Unlock()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if _, ok := ix.entries[k]; !ok {
+		return ErrNotFound
+	}
+	ix.remove(k)
+	ix.add(k, sum, value)
+	return nil
+}
+
+// Tombstones returns the number of removed SpamSums still present in
+// the posting lists.
+func (ix *Index[K, V]) Tombstones() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return ix.tombstones
+}
+
+// Compact rebuilds the posting lists without the tombstones left by
+// Remove and Replace.  Searches continue while it runs; changes to the
+// Index wait until it is done.  It is meant to run in the background,
+// for instance whenever Tombstones grows large compared to Len.
+func (ix *Index[K, V]) Compact() {
+	ix.writeMu.Lock()
+	defer ix.writeMu.Unlock()
+
+	// with writeMu held nothing changes, and the old posting lists
+	// can be read without mu.
+	postings := make(map[key][]int, len(ix.postings))
+	for pk, list := range ix.postings {
+		live := make([]int, 0, len(list))
+		for _, n := range list {
+			if _, ok := ix.numbered[n]; ok {
+				live = append(live, n)
+			}
+		}
+		if len(live) > 0 {
+			postings[pk] = live
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.postings = postings
+	ix.tombstones = 0
+}
+
+// Get returns the SpamSum and value stored under k.
+func (ix *Index[K, V]) Get(k K) (*spamsum.SpamSum, V, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	e, ok := ix.entries[k]
+	return e.sum, e.value, ok
+}
+
+// Len returns the number of SpamSums in the Index.
+func (ix *Index[K, V]) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.entries)
+}
+
+// snapshot returns the entries of the Index in the order they were
+// added.
+func (ix *Index[K, V]) snapshot() []Entry[K, V] {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	numbers := make([]int, 0, len(ix.numbered))
+	for n := range ix.numbered {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	entries := make([]Entry[K, V], len(numbers))
+	for i, n := range numbers {
+		k := ix.numbered[n]
+		entries[i] = Entry[K, V]{k, ix.entries[k].value, ix.entries[k].sum}
+	}
+	return entries
+}
+
+// All returns an iterator over the entries of the Index, in the order
+// they were added.  It iterates over the entries present when
+// iteration starts, so the loop body may change the Index.
+func (ix *Index[K, V]) All() iter.Seq[Entry[K, V]] {
+	return func(yield func(Entry[K, V]) bool) {
+		for _, e := range ix.snapshot() {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the Index, in the order
+// they were added.
+func (ix *Index[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for e := range ix.All() {
+			if !yield(e.Key) {
+				return
+			}
+		}
+	}
+}
+
+// Search returns all stored entries whose SpamSums score at least
+// threshold against query, and more than 0, best first.  Matches with
+// equal scores are in the order they were added.
+func (ix *Index[K, V]) Search(query *spamsum.SpamSum, threshold uint32) []Match[K, V] {
+	matches := make([]Match[K, V], 0)
+	if query.Params() != ix.params {
+		return matches
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	candidates := make(map[int]bool)
+	for pk := range ix.keys(query) {
+		for _, n := range ix.postings[pk] {
+			candidates[n] = true
+		}
+	}
+	numbers := make([]int, 0, len(candidates))
+	for n := range candidates {
+		// tombstones have no key
+		if _, ok := ix.numbered[n]; ok {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		k := ix.numbered[n]
+		e := ix.entries[k]
+		if score, ok := query.CompareAtLeast(*e.sum, max(threshold, 1)); ok {
+			matches = append(matches, Match[K, V]{Entry[K, V]{k, e.value, e.sum}, score})
+		}
+	}
+
+	sortMatches(matches)
+	return matches
+}
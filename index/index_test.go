@@ -0,0 +1,314 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// corpus returns the SpamSums of count random inputs, where every
+// input after the first few is a modified copy of an earlier one.
+func corpus(count int) []*spamsum.SpamSum {
+	random := rand.New(rand.NewSource(39))
+	inputs := make([][]byte, 0, count)
+	sums := make([]*spamsum.SpamSum, 0, count)
+	for i := 0; i < count; i++ {
+		var input []byte
+		if i < 5 {
+			input = make([]byte, 2000+random.Intn(20000))
+			random.Read(input)
+		} else {
+			input = append([]byte(nil), inputs[random.Intn(len(inputs))]...)
+			for j := 0; j < 3; j++ {
+				start := random.Intn(len(input) - 100)
+				random.Read(input[start : start+random.Intn(100)])
+			}
+		}
+		inputs = append(inputs, input)
+		sums = append(sums, spamsum.HashBytes(input))
+	}
+	return sums
+}
+
+func TestSearchFindsAllMatches(t *testing.T) {
+	sums := corpus(50)
+	ix := New[string, struct{}]()
+	for i, sum := range sums {
+		if err := ix.Add(fmt.Sprint(i), sum, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ix.Len() != len(sums) {
+		t.Errorf("Index holds %d sums, expected %d", ix.Len(), len(sums))
+	}
+
+	for _, query := range sums {
+		expected := make(map[string]uint32)
+		for i, sum := range sums {
+			if score := query.Compare(*sum); score > 0 {
+				expected[fmt.Sprint(i)] = score
+			}
+		}
+
+		matches := ix.Search(query, 0)
+		if len(matches) != len(expected) {
+			t.Errorf("Search for %v found %d matches, expected %d", query, len(matches), len(expected))
+		}
+		for i, match := range matches {
+			if expected[match.Key] != match.Score {
+				t.Errorf("%s scores %d, expected %d", match.Key, match.Score, expected[match.Key])
+			}
+			if i > 0 && matches[i-1].Score < match.Score {
+				t.Error("Matches not ordered by score")
+			}
+		}
+	}
+}
+
+func TestSearchThreshold(t *testing.T) {
+	sums := corpus(20)
+	ix := New[string, struct{}]()
+	for i, sum := range sums {
+		ix.Add(fmt.Sprint(i), sum, struct{}{})
+	}
+
+	for _, match := range ix.Search(sums[0], 80) {
+		if match.Score < 80 {
+			t.Errorf("Match %s scores %d, below the threshold", match.Key, match.Score)
+		}
+	}
+	if matches := ix.Search(sums[0], 100); len(matches) == 0 || matches[0].Key != "0" {
+		t.Error("Search should find the query itself")
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	ix := New[string, struct{}]()
+	sum := spamsum.HashBytes([]byte("The quick brown fox jumps over the lazy dog"))
+	if err := ix.Add("fox", sum, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Add("fox", sum, struct{}{}); err != ErrDuplicateID {
+		t.Errorf("Adding a duplicate ID returned %v", err)
+	}
+	if got, _, ok := ix.Get("fox"); !ok || got != sum {
+		t.Error("Get should return the stored sum")
+	}
+
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if err := ix.Add("long", hasher.HashBytes([]byte("fox")), struct{}{}); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Adding a sum with other parameters returned %v", err)
+	}
+}
+
+func TestRemoveAndReplace(t *testing.T) {
+	sums := corpus(30)
+	ix := New[string, struct{}]()
+	for i, sum := range sums[:20] {
+		ix.Add(fmt.Sprint(i), sum, struct{}{})
+	}
+
+	if err := ix.Remove("0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Remove("0"); err != ErrNotFound {
+		t.Errorf("Removing a removed ID returned %v", err)
+	}
+	if err := ix.Replace("0", sums[0], struct{}{}); err != ErrNotFound {
+		t.Errorf("Replacing a removed ID returned %v", err)
+	}
+	if _, _, ok := ix.Get("0"); ok {
+		t.Error("Get should not find a removed ID")
+	}
+	for _, match := range ix.Search(sums[0], 0) {
+		if match.Key == "0" {
+			t.Error("Search should not find a removed ID")
+		}
+	}
+
+	if err := ix.Replace("1", sums[25], struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := ix.Get("1"); got != sums[25] {
+		t.Error("Get should return the replacement")
+	}
+	for _, match := range ix.Search(sums[1], 0) {
+		if match.Key == "1" && match.Sum != sums[25] {
+			t.Error("Search should not find the replaced sum")
+		}
+	}
+	if matches := ix.Search(sums[25], 100); len(matches) == 0 || matches[0].Key != "1" {
+		t.Error("Search should find the replacement")
+	}
+
+	if ix.Len() != 19 || ix.Tombstones() != 2 {
+		t.Errorf("Index holds %d sums and %d tombstones, expected 19 and 2", ix.Len(), ix.Tombstones())
+	}
+	if err := ix.Add("0", sums[0], struct{}{}); err != nil {
+		t.Errorf("Adding a removed ID returned %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	sums := corpus(50)
+	ix := New[string, struct{}]()
+	for i, sum := range sums {
+		ix.Add(fmt.Sprint(i), sum, struct{}{})
+	}
+	for i := 0; i < len(sums); i += 3 {
+		ix.Remove(fmt.Sprint(i))
+	}
+
+	before := make([][]Match[string, struct{}], len(sums))
+	for i, query := range sums {
+		before[i] = ix.Search(query, 0)
+	}
+
+	ix.Compact()
+	if ix.Tombstones() != 0 {
+		t.Errorf("%d tombstones left after compacting", ix.Tombstones())
+	}
+	for _, list := range ix.postings {
+		for _, n := range list {
+			if _, ok := ix.numbered[n]; !ok {
+				t.Fatalf("Posting list still holds removed entry %d", n)
+			}
+		}
+	}
+
+	for i, query := range sums {
+		after := ix.Search(query, 0)
+		if fmt.Sprint(after) != fmt.Sprint(before[i]) {
+			t.Errorf("Search for %v found %v after compacting, %v before", query, after, before[i])
+		}
+	}
+}
+
+func TestConcurrentChanges(t *testing.T) {
+	sums := corpus(60)
+	stable, churn := sums[:20], sums[20:]
+
+	ix := New[string, struct{}]()
+	for i, sum := range stable {
+		ix.Add(fmt.Sprint("stable", i), sum, struct{}{})
+	}
+
+	var writers, readers sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < 3; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			random := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprint("churn", w, "-", random.Intn(10))
+				sum := churn[random.Intn(len(churn))]
+				switch random.Intn(4) {
+				case 0:
+					ix.Add(id, sum, struct{}{})
+				case 1:
+					ix.Remove(id)
+				case 2:
+					ix.Replace(id, sum, struct{}{})
+				default:
+					if w == 0 {
+						ix.Compact()
+					}
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for i, query := range stable {
+					id := fmt.Sprint("stable", i)
+					found := false
+					for _, match := range ix.Search(query, 0) {
+						if match.Key == id {
+							found = match.Score == query.Compare(*query)
+						}
+					}
+					if !found {
+						t.Errorf("Concurrent search lost %s", id)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	ix.Compact()
+	if ix.Len() < len(stable) || ix.Tombstones() != 0 {
+		t.Errorf("Index holds %d sums and %d tombstones after compacting", ix.Len(), ix.Tombstones())
+	}
+}
+
+func TestKeysAndValues(t *testing.T) {
+	type sample struct {
+		customer string
+		size     int
+	}
+
+	sums := corpus(10)
+	ix := New[int, sample]()
+	for i, sum := range sums {
+		if err := ix.Add(100+i, sum, sample{fmt.Sprint("customer ", i%3), i * 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if sum, value, ok := ix.Get(103); !ok || sum != sums[3] || value.customer != "customer 0" || value.size != 30 {
+		t.Errorf("Get returned %v, %v, %v", sum, value, ok)
+	}
+	matches := ix.Search(sums[4], 100)
+	if len(matches) == 0 || matches[0].Key != 104 || matches[0].Value.size != 40 || matches[0].Sum != sums[4] {
+		t.Errorf("Search returned %v", matches)
+	}
+
+	ix.Remove(100)
+	ix.Replace(101, sums[0], sample{"replaced", 0})
+	var keys []int
+	for e := range ix.All() {
+		keys = append(keys, e.Key)
+		if e.Key == 101 && (e.Value.customer != "replaced" || e.Sum != sums[0]) {
+			t.Errorf("All yielded %v for a replaced entry", e)
+		}
+		// changing the index while iterating over it
+		ix.Remove(e.Key)
+	}
+	if fmt.Sprint(keys) != "[102 103 104 105 106 107 108 109 101]" {
+		t.Errorf("All yielded %v, not in the order added", keys)
+	}
+	if ix.Len() != 0 {
+		t.Errorf("%d entries left", ix.Len())
+	}
+
+	ix.Add(1, sums[1], sample{})
+	ix.Add(2, sums[2], sample{})
+	for k := range ix.Keys() {
+		if k != 1 {
+			t.Errorf("Keys yielded %d first", k)
+		}
+		break
+	}
+}
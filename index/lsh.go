@@ -0,0 +1,241 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"errors"
+	"hash/fnv"
+	"iter"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// LSHParams sets the number of MinHash bands of an LSHIndex, and the
+// number of rows in each band.  A digest half becomes a candidate
+// when all rows of any one band agree with the query, which for
+// halves with a Jaccard similarity j between their sets of grams
+// happens with probability 1 - (1 - j^Rows)^Bands.  More bands raise
+// the recall; more rows make the buckets smaller.
+type LSHParams struct {
+	Bands, Rows int
+}
+
+// DefaultLSHParams finds nearly all digests scoring 80 or more
+// against the query, and most of those scoring 50 or more, while
+// comparing well under half the candidates of an Index; run
+// TestLSHRecall with -v for measurements.
+var DefaultLSHParams = LSHParams{Bands: 16, Rows: 1}
+
+var errLSHParams = errors.New("Bands and Rows must both be at least 1")
+
+// bandKey identifies an LSH bucket: the MinHash values of one band of
+// a digest half hashed with blocksize.
+type bandKey struct {
+	blocksize uint32
+	band      int
+	hash      uint64
+}
+
+// An LSHIndex is an approximate alternative to Index, for collections
+// so large that the posting lists of common grams hold too many
+// SpamSums.  Instead of a posting list per gram, it keeps a MinHash
+// signature of the grams of every digest half, split into bands, and
+// only compares the query to SpamSums sharing a band with it.  Its
+// buckets stay small, but SpamSums that share few grams with the
+// query may be missed.  Candidates are scored exactly, so a match is
+// never reported with a wrong score.
+//
+// An LSHIndex is safe for concurrent use.
+type LSHIndex[K comparable, V any] struct {
+	mu       sync.RWMutex
+	params   spamsum.Params
+	lsh      LSHParams
+	entries  map[K]entry[V]
+	numbered []K
+	buckets  map[bandKey][]int
+}
+
+// NewLSH returns an empty LSHIndex for SpamSums made with the default
+// parameters.
+func NewLSH[K comparable, V any](lsh LSHParams) (*LSHIndex[K, V], error) {
+	return NewLSHWithParams[K, V](spamsum.DefaultParams, lsh)
+}
+
+// NewLSHWithParams returns an empty LSHIndex for SpamSums made with
+// params.
+func NewLSHWithParams[K comparable, V any](params spamsum.Params, lsh LSHParams) (*LSHIndex[K, V], error) {
+	if lsh.Bands < 1 || lsh.Rows < 1 {
+		return nil, errLSHParams
+	}
+	return &LSHIndex[K, V]{
+		params:  params,
+		lsh:     lsh,
+		entries: make(map[K]entry[V]),
+		buckets: make(map[bandKey][]int),
+	}, nil
+}
+
+// Params returns the parameters of the SpamSums in the LSHIndex.
+func (ix *LSHIndex[K, V]) Params() spamsum.Params {
+	return ix.params
+}
+
+// LSHParams returns the bands and rows of the LSHIndex.
+func (ix *LSHIndex[K, V]) LSHParams() LSHParams {
+	return ix.lsh
+}
+
+// mix is the finalizer of SplitMix64, which spreads every bit of x
+// over the result.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// bands returns the LSH buckets of sum.  Each of the Bands*Rows
+// MinHash values of a half is the least of one hash function over
+// its grams; each band hashes Rows of them together.
+func (ix *LSHIndex[K, V]) bands(sum *spamsum.SpamSum) []bandKey {
+	parts := strings.SplitN(sum.String(), ":", 3)
+	blocksize := uint32(sum.BlockSize())
+	window := ix.params.Window
+	functions := ix.lsh.Bands * ix.lsh.Rows
+
+	keys := make([]bandKey, 0, 2*ix.lsh.Bands)
+	minima := make([]uint64, functions)
+	h := fnv.New64a()
+	for i, half := range parts[1:] {
+		if len(half) < window {
+			// no grams; Compare would score 0
+			continue
+		}
+		for f := range minima {
+			minima[f] = math.MaxUint64
+		}
+		for j := 0; j+window <= len(half); j++ {
+			h.Reset()
+			h.Write([]byte(half[j : j+window]))
+			gram := h.Sum64()
+			for f := range minima {
+				if v := mix(gram + uint64(f)*0x9e3779b97f4a7c15); v < minima[f] {
+					minima[f] = v
+				}
+			}
+		}
+
+		for band := 0; band < ix.lsh.Bands; band++ {
+			hash := uint64(band)
+			for _, v := range minima[band*ix.lsh.Rows : (band+1)*ix.lsh.Rows] {
+				hash = mix(hash ^ v)
+			}
+			keys = append(keys, bandKey{blocksize << uint(i), band, hash})
+		}
+	}
+	return keys
+}
+
+// Add stores sum under k, along with value, returning the same
+// errors as Index.Add.
+func (ix *LSHIndex[K, V]) Add(k K, sum *spamsum.SpamSum, value V) error {
+	if sum.Params() != ix.params {
+		return spamsum.ErrParamsMismatch
+	}
+	keys := ix.bands(sum)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if _, ok := ix.entries[k]; ok {
+		return ErrDuplicateID
+	}
+	n := len(ix.numbered)
+	ix.entries[k] = entry[V]{sum, value, n}
+	ix.numbered = append(ix.numbered, k)
+	for _, bk := range keys {
+		ix.buckets[bk] = append(ix.buckets[bk], n)
+	}
+	return nil
+}
+
+// Get returns the SpamSum and value stored under k.
+func (ix *LSHIndex[K, V]) Get(k K) (*spamsum.SpamSum, V, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	e, ok := ix.entries[k]
+	return e.sum, e.value, ok
+}
+
+// Len returns the number of SpamSums in the LSHIndex.
+func (ix *LSHIndex[K, V]) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.entries)
+}
+
+// All returns an iterator over the entries of the LSHIndex, in the
+// order they were added.  Entries added during iteration are not
+// included.
+func (ix *LSHIndex[K, V]) All() iter.Seq[Entry[K, V]] {
+	return func(yield func(Entry[K, V]) bool) {
+		ix.mu.RLock()
+		numbered := ix.numbered
+		ix.mu.RUnlock()
+
+		for _, k := range numbered {
+			sum, value, _ := ix.Get(k)
+			if !yield(Entry[K, V]{k, value, sum}) {
+				return
+			}
+		}
+	}
+}
+
+// Search returns stored entries whose SpamSums score at least
+// threshold against query, and more than 0, best first.  Matches with
+// equal scores are in the order they were added.  Unlike
+// Index.Search, it may miss some.
+func (ix *LSHIndex[K, V]) Search(query *spamsum.SpamSum, threshold uint32) []Match[K, V] {
+	matches := make([]Match[K, V], 0)
+	if query.Params() != ix.params {
+		return matches
+	}
+	keys := ix.bands(query)
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	candidates := make(map[int]bool)
+	for _, bk := range keys {
+		for _, n := range ix.buckets[bk] {
+			candidates[n] = true
+		}
+	}
+	numbers := make([]int, 0, len(candidates))
+	for n := range candidates {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		k := ix.numbered[n]
+		e := ix.entries[k]
+		if score, ok := query.CompareAtLeast(*e.sum, max(threshold, 1)); ok {
+			matches = append(matches, Match[K, V]{Entry[K, V]{k, e.value, e.sum}, score})
+		}
+	}
+
+	sortMatches(matches)
+	return matches
+}
@@ -0,0 +1,161 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// recall returns the fraction of the expected matches, those of an
+// exhaustive search for every SpamSum in sums, that lsh finds.  It
+// also returns the mean number of candidates lsh compares per query.
+func recall(lsh *LSHIndex[string, struct{}], sums []*spamsum.SpamSum, threshold uint32, expected [][]Match[string, struct{}]) (float64, float64) {
+	total, found, candidates := 0, 0, 0
+	for i, query := range sums {
+		approximate := make(map[string]uint32)
+		for _, match := range lsh.Search(query, threshold) {
+			approximate[match.Key] = match.Score
+		}
+		for _, match := range expected[i] {
+			total++
+			if approximate[match.Key] == match.Score {
+				found++
+			}
+		}
+
+		distinct := make(map[int]bool)
+		for _, k := range lsh.bands(query) {
+			for _, n := range lsh.buckets[k] {
+				distinct[n] = true
+			}
+		}
+		candidates += len(distinct)
+	}
+	return float64(found) / float64(max(total, 1)), float64(candidates) / float64(len(sums))
+}
+
+// boilerplate returns the SpamSums of count unrelated random inputs,
+// which all start with the same header, so that the posting lists of
+// its grams hold all of them.
+func boilerplate(count int) []*spamsum.SpamSum {
+	random := rand.New(rand.NewSource(47))
+	header := make([]byte, 5000)
+	random.Read(header)
+	sums := make([]*spamsum.SpamSum, 0, count)
+	for i := 0; i < count; i++ {
+		input := make([]byte, 20000+random.Intn(1000))
+		random.Read(input)
+		copy(input, header)
+		sums = append(sums, spamsum.HashBytes(input))
+	}
+	return sums
+}
+
+func TestLSHRecall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Measuring recall takes a while")
+	}
+	sums := append(corpus(150), boilerplate(100)...)
+	exact := New[string, struct{}]()
+	for i, sum := range sums {
+		exact.Add(fmt.Sprint(i), sum, struct{}{})
+	}
+
+	candidates := 0
+	for _, query := range sums {
+		distinct := make(map[string]bool)
+		for k := range exact.keys(query) {
+			for _, n := range exact.postings[k] {
+				distinct[exact.numbered[n]] = true
+			}
+		}
+		candidates += len(distinct)
+	}
+	exhaustive := float64(candidates) / float64(len(sums))
+	t.Logf("Index: %.1f candidates per query", exhaustive)
+
+	thresholds := []uint32{1, 50, 80}
+	expected := make([][][]Match[string, struct{}], len(thresholds))
+	for i, threshold := range thresholds {
+		for _, query := range sums {
+			expected[i] = append(expected[i], exact.Search(query, threshold))
+		}
+	}
+
+	for _, params := range []LSHParams{
+		DefaultLSHParams,
+		{Bands: 32, Rows: 1},
+		{Bands: 128, Rows: 2},
+	} {
+		lsh, err := NewLSH[string, struct{}](params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sum := range sums {
+			lsh.Add(fmt.Sprint(i), sum, struct{}{})
+		}
+		for i, threshold := range thresholds {
+			measured, candidates := recall(lsh, sums, threshold, expected[i])
+			t.Logf("%d bands of %d rows: recall %.3f at threshold %d, %.1f candidates per query",
+				params.Bands, params.Rows, measured, threshold, candidates)
+			if params != DefaultLSHParams {
+				continue
+			}
+			if threshold >= 80 && measured < 0.95 {
+				t.Errorf("Recall %.3f at threshold %d is too low", measured, threshold)
+			}
+			if candidates > exhaustive/2 {
+				t.Errorf("%.1f candidates per query, Index compares %.1f", candidates, exhaustive)
+			}
+		}
+	}
+
+}
+
+func TestLSHIndex(t *testing.T) {
+	if _, err := NewLSH[string, struct{}](LSHParams{Bands: 0, Rows: 4}); err == nil {
+		t.Error("Zero bands should be refused")
+	}
+
+	lsh, _ := NewLSH[string, struct{}](DefaultLSHParams)
+	sums := corpus(20)
+	for i, sum := range sums {
+		if err := lsh.Add(fmt.Sprint(i), sum, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Add("0", sums[0], struct{}{}); err != ErrDuplicateID {
+		t.Errorf("Adding a duplicate ID returned %v", err)
+	}
+	if lsh.Len() != len(sums) {
+		t.Errorf("LSHIndex holds %d sums, expected %d", lsh.Len(), len(sums))
+	}
+
+	for i, query := range sums {
+		matches := lsh.Search(query, 0)
+		found := false
+		for j, match := range matches {
+			if match.Score != query.Compare(*match.Sum) {
+				t.Errorf("%s scores %d, expected %d", match.Key, match.Score, query.Compare(*match.Sum))
+			}
+			if j > 0 && matches[j-1].Score < match.Score {
+				t.Error("Matches not ordered by score")
+			}
+			found = found || match.Key == fmt.Sprint(i)
+		}
+		if !found {
+			t.Errorf("Search for %v should find itself", query)
+		}
+	}
+
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if err := lsh.Add("long", hasher.HashBytes([]byte("fox")), struct{}{}); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Adding a sum with other parameters returned %v", err)
+	}
+}
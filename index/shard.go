@@ -0,0 +1,184 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// A ConflictPolicy decides what MergeIndexes does with an ID stored in
+// more than one shard.
+type ConflictPolicy int
+
+const (
+	// KeepFirst keeps the SpamSum of the first shard holding the ID.
+	KeepFirst ConflictPolicy = iota
+	// KeepLast keeps the SpamSum of the last shard holding the ID,
+	// so that later shards override earlier ones.
+	KeepLast
+	// RejectConflicts makes MergeIndexes fail with ErrDuplicateID
+	// if shards store different SpamSums under the ID.
+	RejectConflicts
+)
+
+// MergeIndexes combines the index files inputs, written by Builders
+// or earlier merges, into a single index file out.  IDs stored in
+// more than one input are resolved by policy.  All inputs must have
+// the same parameters, or spamsum.ErrParamsMismatch is returned.  Out
+// is replaced atomically, and may be one of the inputs.
+func MergeIndexes(out string, policy ConflictPolicy, inputs ...string) error {
+	var params *spamsum.Params
+	sums := make(map[string]*spamsum.SpamSum)
+	for _, input := range inputs {
+		shard, err := Open(input)
+		if err != nil {
+			return err
+		}
+		err = mergeShard(sums, shard, policy)
+		if params == nil {
+			p := shard.Params()
+			params = &p
+		} else if shard.Params() != *params {
+			err = spamsum.ErrParamsMismatch
+		}
+		shard.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+	}
+
+	builder := NewBuilder()
+	if params != nil {
+		builder = NewBuilderWithParams(*params)
+	}
+	for id, sum := range sums {
+		if err := builder.Add(id, sum); err != nil {
+			return err
+		}
+	}
+	return builder.WriteFile(out)
+}
+
+// mergeShard adds the SpamSums of shard to sums, as directed by
+// policy.
+func mergeShard(sums map[string]*spamsum.SpamSum, shard *DiskIndex, policy ConflictPolicy) error {
+	for n := 0; n < shard.Len(); n++ {
+		id := shard.id(n)
+		sum, err := shard.sum(n)
+		if err != nil {
+			return corrupt(err.Error())
+		}
+
+		if existing, ok := sums[id]; ok {
+			switch policy {
+			case KeepFirst:
+				continue
+			case RejectConflicts:
+				if existing.String() != sum.String() {
+					return fmt.Errorf("%w: %q", ErrDuplicateID, id)
+				}
+			}
+		}
+		sums[id] = sum
+	}
+	return nil
+}
+
+// A Shard is one part of a ShardedIndex.  Index, LSHIndex and, for
+// string keys without values, DiskIndex are Shards.
+type Shard[K comparable, V any] interface {
+	Params() spamsum.Params
+	Len() int
+	Search(query *spamsum.SpamSum, threshold uint32) []Match[K, V]
+}
+
+// A ShardedIndex searches a number of Shards as one collection, for
+// instance an index file per day of collected spam and an Index of
+// today's.  The Shards are searched concurrently.  A ShardedIndex is
+// safe for concurrent use if its Shards are.
+type ShardedIndex[K comparable, V any] struct {
+	params spamsum.Params
+	shards []Shard[K, V]
+}
+
+// NewShardedIndex returns a ShardedIndex of shards, which must all
+// have the same parameters.
+func NewShardedIndex[K comparable, V any](shards ...Shard[K, V]) (*ShardedIndex[K, V], error) {
+	params := spamsum.DefaultParams
+	for i, shard := range shards {
+		if i == 0 {
+			params = shard.Params()
+		} else if shard.Params() != params {
+			return nil, spamsum.ErrParamsMismatch
+		}
+	}
+	return &ShardedIndex[K, V]{params, append([]Shard[K, V](nil), shards...)}, nil
+}
+
+// Params returns the parameters of the SpamSums in the ShardedIndex.
+func (ix *ShardedIndex[K, V]) Params() spamsum.Params {
+	return ix.params
+}
+
+// Len returns the number of SpamSums in all shards.  Keys stored in
+// more than one shard are counted more than once.
+func (ix *ShardedIndex[K, V]) Len() int {
+	total := 0
+	for _, shard := range ix.shards {
+		total += shard.Len()
+	}
+	return total
+}
+
+// Search returns all entries in any shard whose SpamSums score at
+// least threshold against query, and more than 0, best first.
+// Matches with equal scores are in shard order, and within a shard in
+// the order of its own Search.  A key matching in more than one shard
+// is reported once, with its best score.
+func (ix *ShardedIndex[K, V]) Search(query *spamsum.SpamSum, threshold uint32) []Match[K, V] {
+	return ix.Top(query, threshold, 0)
+}
+
+// Top is Search, returning no more than the limit best matches.  A
+// limit of 0 means no limit.
+func (ix *ShardedIndex[K, V]) Top(query *spamsum.SpamSum, threshold uint32, limit int) []Match[K, V] {
+	results := make([][]Match[K, V], len(ix.shards))
+	var wg sync.WaitGroup
+	for i, shard := range ix.shards {
+		wg.Add(1)
+		go func(i int, shard Shard[K, V]) {
+			defer wg.Done()
+			results[i] = shard.Search(query, threshold)
+			// no match past the limit of a shard can make the
+			// limit overall.
+			if limit > 0 && len(results[i]) > limit {
+				results[i] = results[i][:limit]
+			}
+		}(i, shard)
+	}
+	wg.Wait()
+
+	best := make(map[K]int)
+	matches := make([]Match[K, V], 0)
+	for _, result := range results {
+		for _, match := range result {
+			if i, ok := best[match.Key]; !ok {
+				best[match.Key] = len(matches)
+				matches = append(matches, match)
+			} else if match.Score > matches[i].Score {
+				matches[i] = match
+			}
+		}
+	}
+
+	sortMatches(matches)
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
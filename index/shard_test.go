@@ -0,0 +1,181 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// writeShard writes sums to an index file under the given IDs, and
+// returns its path.
+func writeShard(t *testing.T, ids []string, sums []*spamsum.SpamSum) string {
+	builder := NewBuilder()
+	for i, sum := range sums {
+		if err := builder.Add(ids[i], sum); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "shard")
+	if err := builder.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sameMatches compares matches regardless of the order of those with
+// equal scores, which depends on the order of the shards.
+func sameMatches(t *testing.T, actual, expected []Match[string, struct{}]) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("Found %d matches, expected %d", len(actual), len(expected))
+	}
+	for _, matches := range [][]Match[string, struct{}]{actual, expected} {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].Score != matches[j].Score {
+				return matches[i].Score > matches[j].Score
+			}
+			return matches[i].Key < matches[j].Key
+		})
+	}
+	for i := range expected {
+		if actual[i].Key != expected[i].Key || actual[i].Score != expected[i].Score ||
+			actual[i].Sum.String() != expected[i].Sum.String() {
+			t.Errorf("Found %v, expected %v", actual[i], expected[i])
+		}
+	}
+}
+
+func TestMergeIndexes(t *testing.T) {
+	sums := corpus(30)
+	first := writeShard(t, []string{"a", "b", "c"}, sums[0:3])
+	second := writeShard(t, []string{"c", "d"}, sums[3:5])
+	same := writeShard(t, []string{"a"}, sums[0:1])
+
+	for _, test := range []struct {
+		policy ConflictPolicy
+		c      *spamsum.SpamSum
+	}{
+		{KeepFirst, sums[2]},
+		{KeepLast, sums[3]},
+	} {
+		out := filepath.Join(t.TempDir(), "merged")
+		if err := MergeIndexes(out, test.policy, first, second); err != nil {
+			t.Fatal(err)
+		}
+		merged, err := Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged.Len() != 4 {
+			t.Errorf("Merged index holds %d sums, expected 4", merged.Len())
+		}
+		if c, _ := merged.Get("c"); c == nil || c.String() != test.c.String() {
+			t.Errorf("Policy %d kept %v under c, expected %v", test.policy, c, test.c)
+		}
+		merged.Close()
+	}
+
+	out := filepath.Join(t.TempDir(), "merged")
+	if err := MergeIndexes(out, RejectConflicts, first, second); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Merging conflicting shards returned %v", err)
+	}
+	if err := MergeIndexes(out, RejectConflicts, first, same); err != nil {
+		t.Errorf("Identical duplicates should merge, got %v", err)
+	}
+
+	// merging into one of the inputs
+	if err := MergeIndexes(first, KeepFirst, first, second); err != nil {
+		t.Fatal(err)
+	}
+	if merged, err := Open(first); err != nil || merged.Len() != 4 {
+		t.Errorf("Merging into an input failed: %v", err)
+	} else {
+		merged.Close()
+	}
+
+	builder := NewBuilderWithParams(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	long := filepath.Join(t.TempDir(), "long")
+	builder.WriteFile(long)
+	if err := MergeIndexes(out, KeepFirst, second, long); !errors.Is(err, spamsum.ErrParamsMismatch) {
+		t.Errorf("Merging shards with different parameters returned %v", err)
+	}
+}
+
+func TestShardedIndexSearch(t *testing.T) {
+	sums := corpus(60)
+	whole := New[string, struct{}]()
+	shards := make([]Shard[string, struct{}], 0, 5)
+	for s := 0; s < 3; s++ {
+		ids := make([]string, 0, 20)
+		for i := s * 20; i < (s+1)*20; i++ {
+			ids = append(ids, fmt.Sprint(i))
+			whole.Add(fmt.Sprint(i), sums[i], struct{}{})
+		}
+		shard, err := Open(writeShard(t, ids, sums[s*20:(s+1)*20]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer shard.Close()
+		shards = append(shards, shard)
+	}
+	memory := New[string, struct{}]()
+	memory.Add("memory", sums[59], struct{}{})
+	whole.Add("memory", sums[59], struct{}{})
+	shards = append(shards, memory)
+
+	sharded, err := NewShardedIndex(shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sharded.Len() != 61 {
+		t.Errorf("Sharded index holds %d sums, expected 61", sharded.Len())
+	}
+
+	for _, query := range sums[1:58] {
+		expected := whole.Search(query, 0)
+		top := sharded.Top(query, 0, 3)
+		sameMatches(t, sharded.Search(query, 0), expected)
+
+		// which of several matches with equal scores makes the
+		// top depends on the order of the shards
+		scores := make(map[string]uint32)
+		for _, match := range expected {
+			scores[match.Key] = match.Score
+		}
+		if len(top) != min(3, len(expected)) {
+			t.Fatalf("Top found %d matches, expected %d", len(top), min(3, len(expected)))
+		}
+		for i, match := range top {
+			if match.Score != expected[i].Score || scores[match.Key] != match.Score {
+				t.Errorf("Top found %v, expected a score of %d", match, expected[i].Score)
+			}
+		}
+	}
+
+	// an ID in two shards is reported once, with its best score
+	duplicate := New[string, struct{}]()
+	duplicate.Add("0", sums[59], struct{}{})
+	sharded, _ = NewShardedIndex(append(shards, duplicate)...)
+	matches := sharded.Search(sums[59], 100)
+	if len(matches) != 3 {
+		t.Errorf("Search for a duplicated ID found %v", matches)
+	}
+	for _, match := range matches {
+		if match.Key == "0" && match.Sum != sums[59] {
+			t.Errorf("Search found %v, not the best match for 0", match)
+		}
+	}
+
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if _, err := NewShardedIndex[string, struct{}](duplicate, NewWithParams[string, struct{}](hasher.Params())); err != spamsum.ErrParamsMismatch {
+		t.Errorf("Shards with different parameters returned %v", err)
+	}
+}
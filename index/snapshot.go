@@ -0,0 +1,92 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+const snapshotHeader = "spamsum-index"
+
+// Write writes a snapshot of ix to w, in a line-oriented text format
+// that Read reads back.  The first line holds the parameters and the
+// number of SpamSums, each following line a SpamSum and its quoted
+// ID, in the order they were added.  Posting lists are not written;
+// Read rebuilds them.
+func Write(w io.Writer, ix *Index[string, struct{}]) (int64, error) {
+	entries := ix.snapshot()
+
+	var written int64
+	writer := bufio.NewWriter(w)
+	count := func(n int, err error) error {
+		written += int64(n)
+		return err
+	}
+
+	if err := count(fmt.Fprintf(writer, "%s %d %d %d %d\n", snapshotHeader,
+		ix.params.SignatureLength, ix.params.Window, ix.params.MinBlockSize,
+		len(entries))); err != nil {
+		return written, err
+	}
+	for _, e := range entries {
+		if err := count(fmt.Fprintf(writer, "%v %s\n", e.Sum, strconv.Quote(e.Key))); err != nil {
+			return written, err
+		}
+	}
+	return written, writer.Flush()
+}
+
+// Read reads an Index written by Write.
+func Read(r io.Reader) (*Index[string, struct{}], error) {
+	reader := bufio.NewReader(r)
+
+	var header string
+	var params spamsum.Params
+	var entries int
+	if _, err := fmt.Fscanf(reader, "%s %d %d %d %d\n", &header,
+		&params.SignatureLength, &params.Window, &params.MinBlockSize,
+		&entries); err != nil {
+		return nil, err
+	} else if header != snapshotHeader {
+		return nil, errors.New("Not a spamsum index")
+	}
+
+	hasher, err := spamsum.NewHasher(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := NewWithParams[string, struct{}](params)
+	for i := 0; i < entries; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		digest, quoted, found := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		if !found {
+			return nil, errors.New("Invalid index entry")
+		}
+		id, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hasher.Parse(digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := ix.Add(id, sum, struct{}{}); err != nil {
+			return nil, err
+		}
+	}
+	return ix, nil
+}
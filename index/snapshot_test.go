@@ -0,0 +1,67 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	sums := corpus(20)
+	ix := New[string, struct{}]()
+	for i, sum := range sums {
+		ix.Add(fmt.Sprintf("file %d\n", i), sum, struct{}{})
+	}
+
+	var buffer bytes.Buffer
+	if _, err := Write(&buffer, ix); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buffer.String()
+
+	read, err := Read(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Len() != ix.Len() {
+		t.Fatalf("Read %d sums, expected %d", read.Len(), ix.Len())
+	}
+
+	for _, query := range sums {
+		expected, actual := ix.Search(query, 0), read.Search(query, 0)
+		if len(expected) != len(actual) {
+			t.Fatalf("Read index finds %d matches, expected %d", len(actual), len(expected))
+		}
+		for i := range expected {
+			if expected[i].Key != actual[i].Key || expected[i].Score != actual[i].Score {
+				t.Errorf("Read index finds %v, expected %v", actual[i], expected[i])
+			}
+		}
+	}
+
+	buffer.Reset()
+	Write(&buffer, read)
+	if buffer.String() != snapshot {
+		t.Error("Snapshots of equal indexes differ")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, snapshot := range []string{
+		"",
+		"spamsum-corpus 64 7 3 0\n",
+		"spamsum-index 64 7 3 1\n",
+		"spamsum-index 64 7 3 1\n3:abc\n",
+		"spamsum-index 64 7 3 1\n3:abc:de unquoted\n",
+		"spamsum-index 64 7 3 2\n3:abc:de \"a\"\n3:abc:de \"a\"\n",
+	} {
+		if _, err := Read(strings.NewReader(snapshot)); err == nil {
+			t.Errorf("Reading %q should fail", snapshot)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package report renders the comparison of two SpamSums as a
+// self-contained HTML page, showing both signatures aligned
+// character by character, the score breakdown, and, when traces are
+// available, the byte ranges the inputs have in common.
+package report
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"os"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+// An Input is one side of a report.  Trace may be nil, in which case
+// no byte ranges are listed.
+type Input struct {
+	Name  string
+	Sum   *spamsum.SpamSum
+	Trace *spamsum.Trace
+}
+
+// HashFile takes the traced SpamSum of the named file.
+func HashFile(path string) (Input, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Input{}, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return Input{}, err
+	}
+
+	sum, trace, err := spamsum.HashReadSeekerTraced(file, stat.Size())
+	if err != nil {
+		return Input{}, err
+	}
+	return Input{path, sum, trace}, nil
+}
+
+// cell is one column of an aligned pair of digest halves.  From or
+// To is empty for insertions and deletions.
+type cell struct {
+	From, To string
+	Op       spamsum.EditOp
+}
+
+type part struct {
+	spamsum.PartComparison
+	Cells []cell
+}
+
+type page struct {
+	From, To Input
+	Score    uint32
+	Parts    []part
+	Mismatch bool
+	Traced   bool
+	Regions  []spamsum.SharedRegion
+}
+
+// align lays out the edit script of a part as a sequence of cells.
+func align(comparison spamsum.PartComparison) []cell {
+	cells := make([]cell, 0, len(comparison.Script))
+	i, j := 0, 0
+	for _, op := range comparison.Script {
+		var c cell
+		c.Op = op
+		if op != spamsum.EditInsert {
+			c.From = string(comparison.From[i])
+			i++
+		}
+		if op != spamsum.EditDelete {
+			c.To = string(comparison.To[j])
+			j++
+		}
+		cells = append(cells, c)
+	}
+	return cells
+}
+
+// Write renders the comparison of from and to as an HTML page.
+func Write(w io.Writer, from, to Input) error {
+	comparison := from.Sum.Explain(*to.Sum)
+
+	p := page{From: from, To: to, Score: comparison.Score}
+	if hasher, err := spamsum.NewHasher(from.Sum.Params()); err == nil {
+		_, err = hasher.Compare(from.Sum, to.Sum)
+		p.Mismatch = errors.Is(err, spamsum.ErrParamsMismatch)
+	}
+	for _, comparedPart := range comparison.Parts {
+		p.Parts = append(p.Parts, part{comparedPart, align(comparedPart)})
+	}
+
+	if from.Trace != nil && to.Trace != nil {
+		p.Traced = true
+		p.Regions = spamsum.SharedRegions(from.Sum, from.Trace, to.Sum, to.Trace)
+	}
+
+	return reportTemplate.Execute(w, p)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>spamsum comparison: {{.From.Name}} and {{.To.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.2em 0.6em; }
+.signature td { font-family: monospace; padding: 0 0.05em; text-align: center; }
+.match { background: #b6e3b6; }
+.substitute { background: #f5d58c; }
+.insert { background: #a9c8f0; }
+.delete { background: #f0a9a9; }
+.legend span { padding: 0 0.5em; margin-right: 0.5em; }
+</style>
+</head>
+<body>
+<h1>Similarity {{.Score}}</h1>
+<table>
+<tr><th>From</th><td>{{.From.Name}}</td><td><code>{{.From.Sum}}</code></td></tr>
+<tr><th>To</th><td>{{.To.Name}}</td><td><code>{{.To.Sum}}</code></td></tr>
+</table>
+<p class="legend"><span class="match">matched</span><span class="substitute">substituted</span><span class="insert">inserted</span><span class="delete">deleted</span></p>
+{{range .Parts}}
+<h2>Block size {{.BlockSize}}</h2>
+<table class="signature">
+<tr>{{range .Cells}}<td class="{{.Op}}">{{.From}}</td>{{end}}</tr>
+<tr>{{range .Cells}}<td class="{{.Op}}">{{.To}}</td>{{end}}</tr>
+</table>
+<table>
+<tr><th>Common substring</th><td>{{if .CommonSubstring}}yes{{else}}no, score is 0{{end}}</td></tr>
+<tr><th>Edit distance</th><td>{{.Distance}}</td></tr>
+<tr><th>Score from edit distance</th><td>{{.DistanceScore}}</td></tr>
+<tr><th>Cap for block size</th><td>{{.Cap}}</td></tr>
+<tr><th>Score</th><td>{{.Score}}</td></tr>
+</table>
+{{else}}{{if .Mismatch}}
+<p>The signatures were made with different parameters; they cannot be compared.</p>
+{{else}}
+<p>The block sizes differ by more than a factor of two; the signatures cannot be compared.</p>
+{{end}}{{end}}
+{{if .Traced}}
+<h2>Shared byte ranges</h2>
+{{if .Regions}}
+<table>
+<tr><th>Block size</th><th>{{.From.Name}}</th><th>{{.To.Name}}</th></tr>
+{{range .Regions}}<tr><td>{{.BlockSize}}</td><td>{{.From.Start}}&ndash;{{.From.End}}</td><td>{{.To.Start}}&ndash;{{.To.End}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No shared byte ranges.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
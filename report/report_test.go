@@ -0,0 +1,92 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michielbuddingh/spamsum"
+)
+
+func scan(t *testing.T, s string) *spamsum.SpamSum {
+	sum := new(spamsum.SpamSum)
+	if _, err := fmt.Sscan(s, sum); err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestWrite(t *testing.T) {
+	from := Input{"first", scan(t, "48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs"), nil}
+	to := Input{"second", scan(t, "48:w+wNj5GLBX/8jrT14EHWFIUXs0hPbaL3qd9hI6h0:w+zLBX/w14EecWT6ad9hs"), nil}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, from, to); err != nil {
+		t.Fatal(err)
+	}
+	page := buffer.String()
+
+	for _, expected := range []string{
+		"<h1>Similarity 77</h1>",
+		`<td class="match">w</td>`,
+		`<td class="insert">`,
+		`<td class="delete">`,
+		"Block size 96",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Report does not contain %q", expected)
+		}
+	}
+	if strings.Contains(page, "Shared byte ranges") {
+		t.Errorf("Report without traces lists byte ranges")
+	}
+}
+
+func TestWriteIncomparable(t *testing.T) {
+	from := Input{"small", scan(t, "3:Bl5KOiWl/:ldZ/"), nil}
+	to := Input{"large", scan(t, "12582912:kVxeXup8VuH8rD//4crHBrlGXm5WgYJ70A:e4XuptH8D//4crHMmUfL"), nil}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "block sizes differ") {
+		t.Errorf("Report does not say the block sizes differ")
+	}
+
+	hasher, _ := spamsum.NewHasher(spamsum.Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	long := Input{"long", hasher.HashBytes([]byte("The quick brown fox jumps over the lazy dog")), nil}
+	buffer.Reset()
+	if err := Write(&buffer, from, long); err != nil {
+		t.Fatal(err)
+	}
+	if page := buffer.String(); !strings.Contains(page, "different parameters") || strings.Contains(page, "block sizes differ") {
+		t.Errorf("Report does not say the signatures were made with different parameters")
+	}
+}
+
+func TestWriteTraced(t *testing.T) {
+	from, err := HashFile(filepath.Join("..", "testdata", "LAND.MAP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, from, from); err != nil {
+		t.Fatal(err)
+	}
+	page := buffer.String()
+
+	if !strings.Contains(page, "<h1>Similarity 100</h1>") {
+		t.Errorf("A file compared to itself should score 100")
+	}
+	if !strings.Contains(page, "<td>768</td><td>0&ndash;") {
+		t.Errorf("Report does not list the shared byte ranges of a file and itself")
+	}
+}
@@ -25,11 +25,29 @@ const (
 	prime32       = uint32(16777619)
 )
 
+// A SpamSum is the fuzzy hash of an input.  Its halves are slices, so
+// SpamSums are not comparable with ==; compare their String() results
+// instead.  A copy of the SpamSum embedded in a SpamSumWriter shares
+// its halves, and changes as more is written, but not after Reset.
 type SpamSum struct {
 	blocksize             uint32
-	leftPart              [SpamsumLength]byte
-	rightPart             [SpamsumLength / 2]byte
+	leftPart, rightPart   []byte
 	leftIndex, rightIndex int
+	params                Params
+	options               DigestOptions
+}
+
+// parameters returns the Params this sum was made with.
+func (ss *SpamSum) parameters() Params {
+	return ss.params.orDefault()
+}
+
+// clone returns a copy of ss that does not share storage with it.
+func (ss *SpamSum) clone() SpamSum {
+	c := *ss
+	c.leftPart = append([]byte(nil), ss.leftPart...)
+	c.rightPart = append([]byte(nil), ss.rightPart...)
+	return c
 }
 
 // String produces the canonical representation of a spamsum. a
@@ -41,8 +59,8 @@ type SpamSum struct {
 func (ss *SpamSum) String() string {
 	return fmt.Sprintf("%d:%s:%s",
 		ss.blocksize,
-		string(ss.leftPart[:nonZeroLength(ss.leftPart[:])]),
-		string(ss.rightPart[:nonZeroLength(ss.rightPart[:])]))
+		string(ss.leftPart[:nonZeroLength(ss.leftPart)]),
+		string(ss.rightPart[:nonZeroLength(ss.rightPart)]))
 }
 
 // BlockSize returns the approximate block size used in this sum.
@@ -52,16 +70,17 @@ func (ss *SpamSum) BlockSize() int {
 	return int(ss.blocksize)
 }
 
+// Params returns the parameters this sum was made with.
+func (ss *SpamSum) Params() Params {
+	return ss.parameters()
+}
+
 // HashBytes takes a byte slice, and takes its SpamSum, calculating
 // the optimal block size in several passes.  Since adding more data
 // to such a sum would invalidate the block size calculation, this
 // SpamSum can not be added to.
 func HashBytes(b []byte) *SpamSum {
-	wrapper := io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
-	// we discard the error, since they won't be produced
-	// for an in-memory byte slice
-	result, _ := HashReadSeeker(wrapper, wrapper.Size())
-	return result
+	return defaultHasher.HashBytes(b)
 }
 
 // HashReadSeeker requires an implementation of io.ReadSeeker, and a length
@@ -72,14 +91,25 @@ func HashBytes(b []byte) *SpamSum {
 // SpamSum can not be added to.  Any errors returned will originate
 // from the implementation of ReadSeeker.
 func HashReadSeeker(source io.ReadSeeker, length int64) (*SpamSum, error) {
-	sum := new(SpamSum)
-	sum.blocksize = minBlockSize
+	return defaultHasher.hashReadSeeker(source, length, nil, nil)
+}
+
+// hashReadSeeker implements HashReadSeeker.  If trace is not nil, it
+// is filled in during the final pass.  If firstPass is not nil, all
+// data read during the first pass is also written to it.
+func (h *Hasher) hashReadSeeker(source io.ReadSeeker, length int64, trace *Trace, firstPass io.Writer) (*SpamSum, error) {
+	sum := h.newSum()
+	sum.blocksize = h.params.MinBlockSize
 
-	for int64(sum.blocksize*SpamsumLength) < length {
+	for int64(sum.blocksize)*int64(h.params.SignatureLength) < length {
 		sum.blocksize *= 2
 	}
 
 	sss := spamsumState{}
+	sss.init(h.params)
+	if trace != nil {
+		sss.tracer = &tracer{trace: trace}
+	}
 source_iteration:
 	for {
 		sss.reset()
@@ -98,6 +128,9 @@ source_iteration:
 				break block_read_loop
 			} else {
 				processBlock(block, num, &sss, sum)
+				if firstPass != nil {
+					firstPass.Write(block[:num])
+				}
 			}
 
 			if err != nil {
@@ -106,110 +139,177 @@ source_iteration:
 		}
 
 		writeTail(&sss, sum)
+		firstPass = nil
 
-		if sum.blocksize > minBlockSize && sum.leftIndex < (SpamsumLength/2) {
+		if sum.blocksize > h.params.MinBlockSize &&
+			sum.leftIndex < (h.params.SignatureLength/2) {
 			sum.blocksize /= 2
 		} else {
 			break source_iteration
 		}
 	}
 
+	sum.countTail()
+	if h.options.EliminateSequences {
+		sum.eliminateSequences()
+	}
 	return sum, nil
 }
 
 type spamsumState struct {
-	// fields for the rolling hash
-	window                              [rollingWindow]byte
-	rollingSum, h2, shiftHash, position uint32
+	rolling RollingHash
 
 	// FNV-1 style hash fields
 	left, right uint32
+
+	// only set when tracing
+	tracer *tracer
+}
+
+// clone returns a copy of state that can be updated without affecting
+// state.
+func (state *spamsumState) clone() spamsumState {
+	clone := *state
+	clone.rolling = state.rolling.clone()
+	return clone
 }
 
 const b64 string = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
 
+// processBlock feeds the first length bytes of block through the
+// rolling hash and both block hashes.  This is where nearly all time
+// is spent, so RollingHash.Roll is inlined by hand, and all state is
+// kept in local variables until the end of the block.
 func processBlock(block []byte, length int, sss *spamsumState, sum *SpamSum) {
-	for i := 0; i < length; i++ {
-		sss.h2 -= sss.rollingSum
-		sss.h2 += rollingWindow * uint32(block[i])
-
-		sss.rollingSum += uint32(block[i])
-		sss.rollingSum -= uint32(sss.window[sss.position%rollingWindow])
-
-		sss.window[sss.position%rollingWindow] = block[i]
-		sss.position += 1
-
-		sss.shiftHash <<= 5
-		sss.shiftHash ^= uint32(block[i])
-
-		roll := sss.rollingSum + sss.h2 + sss.shiftHash
+	rh := &sss.rolling
+	if rh.window == nil {
+		rh.window = make([]byte, rollingWindow)
+	}
+	window := rh.window
+	size := uint32(len(window))
+	rollingSum, h2, shiftHash, position := rh.rollingSum, rh.h2, rh.shiftHash, rh.position
+	left, right := sss.left, sss.right
+
+	blocksize := sum.blocksize
+	// A trigger needs roll%blocksize == blocksize-1, so the bits of
+	// roll below the lowest set bit of blocksize must all be set.
+	// Block sizes are normally 3 times a power of two, and this
+	// cheap test rules out all but a few bytes before the division.
+	mask := (blocksize & -blocksize) - 1
+
+	for i, c := range block[:length] {
+		h2 -= rollingSum
+		h2 += size * uint32(c)
+		rollingSum += uint32(c)
+		rollingSum -= uint32(window[position])
+		window[position] = c
+		if position++; position == size {
+			position = 0
+		}
+		shiftHash = shiftHash<<5 ^ uint32(c)
 
 		// left and right are Fowler/Noll/Vo-1 hashes with a
 		// slightly different starting value.
-		sss.left *= prime32
-		sss.left ^= uint32(block[i])
-
-		sss.right *= prime32
-		sss.right ^= uint32(block[i])
+		left = left*prime32 ^ uint32(c)
+		right = right*prime32 ^ uint32(c)
 
 		// Assuming the output of the rolling sum is uniformly
 		// distributed, this condition will occur once every
 		// blocksize bytes.  This means that the expected value
 		// for the length of the blocks hashed is blocksize.
-		if roll%sum.blocksize == (sum.blocksize - 1) {
-			sum.leftPart[sum.leftIndex] = b64[sss.left%64]
-			// Note that this means that the first 63 bytes of the
-			// hash will encode the first 63*blocksize blocks,
-			// and the last byte will encode the remainder, be it
-			// one block, or 4GB.
-			if sum.leftIndex < SpamsumLength-1 {
-				sum.leftIndex += 1
-				sss.left = offset32
+		roll := rollingSum + h2 + shiftHash
+		if roll&mask != mask || roll%blocksize != blocksize-1 {
+			continue
+		}
+
+		sum.leftPart[sum.leftIndex] = b64[left%64]
+		if sss.tracer != nil {
+			sss.tracer.left(sum.leftIndex, int64(i)+1)
+		}
+		// Note that this means that the first 63 bytes of the
+		// hash will encode the first 63*blocksize blocks,
+		// and the last byte will encode the remainder, be it
+		// one block, or 4GB.
+		if sum.leftIndex < len(sum.leftPart)-1 {
+			sum.leftIndex += 1
+			left = offset32
+			if sss.tracer != nil {
+				sss.tracer.leftStart = sss.tracer.offset + int64(i) + 1
 			}
 		}
 
-		// As for the previous condition, but for blocksize * 2
-		if roll%(sum.blocksize*2) == ((sum.blocksize * 2) - 1) {
-			sum.rightPart[sum.rightIndex] = b64[sss.right%64]
-			if sum.rightIndex < (SpamsumLength/2)-1 {
+		// As for the previous condition, but for blocksize * 2,
+		// which can only hold if the previous one does.
+		if roll%(blocksize*2) == (blocksize*2)-1 {
+			sum.rightPart[sum.rightIndex] = b64[right%64]
+			if sss.tracer != nil {
+				sss.tracer.right(sum.rightIndex, int64(i)+1)
+			}
+			if sum.rightIndex < len(sum.rightPart)-1 {
 				sum.rightIndex += 1
-				sss.right = offset32
+				right = offset32
+				if sss.tracer != nil {
+					sss.tracer.rightStart = sss.tracer.offset + int64(i) + 1
+				}
 			}
 		}
 	}
+
+	rh.rollingSum, rh.h2, rh.shiftHash, rh.position = rollingSum, h2, shiftHash, position
+	sss.left, sss.right = left, right
+
+	if sss.tracer != nil {
+		sss.tracer.offset += int64(length)
+	}
 }
 
 func writeTail(sss *spamsumState, sum *SpamSum) {
-	roll := sss.rollingSum + sss.h2 + sss.shiftHash
+	roll := sss.rolling.Sum32()
 	if roll != 0 {
 		sum.leftPart[sum.leftIndex] = b64[sss.left%64]
 		sum.rightPart[sum.rightIndex] = b64[sss.right%64]
+		if sss.tracer != nil {
+			sss.tracer.left(sum.leftIndex, 0)
+			sss.tracer.right(sum.rightIndex, 0)
+		}
 	}
 }
 
-func (sss *spamsumState) reset() {
-	for i := range sss.window {
-		sss.window[i] = 0
-	}
+// countTail extends the indices of a finished sum over the characters
+// that writeTail, or the last block of a full half, left after them,
+// so that Compare looks at the same characters String emits.
+func (sum *SpamSum) countTail() {
+	sum.leftIndex = nonZeroLength(sum.leftPart)
+	sum.rightIndex = nonZeroLength(sum.rightPart)
+}
 
-	sss.rollingSum = 0
-	sss.h2 = 0
-	sss.shiftHash = 0
-	sss.position = 0
+// init prepares a spamsumState for hashing with params.
+func (sss *spamsumState) init(params Params) {
+	sss.rolling = *NewRollingHash(params.Window)
+	sss.reset()
+}
+
+func (sss *spamsumState) reset() {
+	sss.rolling.Reset()
 
 	sss.left = offset32
 	sss.right = offset32
-}
 
-func (sum *SpamSum) reset() {
-	for i := range sum.leftPart {
-		sum.leftPart[i] = 0
+	if sss.tracer != nil {
+		sss.tracer.reset()
 	}
+}
 
-	for i := range sum.rightPart {
-		sum.rightPart[i] = 0
+// reset empties the sum by giving it new storage for its parameters,
+// leaving copies of the sum that share the old storage unchanged.
+func (sum *SpamSum) reset() {
+	params := sum.parameters()
+	rightLength := params.SignatureLength / 2
+	if sum.options.NoTruncate {
+		rightLength = params.SignatureLength
 	}
-
+	sum.leftPart = make([]byte, params.SignatureLength)
+	sum.rightPart = make([]byte, rightLength)
 	sum.leftIndex, sum.rightIndex = 0, 0
 }
 
@@ -223,7 +323,12 @@ func nonZeroLength(array []byte) (r int) {
 	return r
 }
 
+// Scan reads a SpamSum in the form produced by String.  The lengths
+// and block size are checked against the parameters of sum, which
+// are the defaults unless sum was made by a Hasher.  The second half
+// may be as long as the first, as produced with NoTruncate.
 func (sum *SpamSum) Scan(state fmt.ScanState, verb rune) error {
+	params := sum.parameters()
 	var blocksize int
 	var leftPart, rightPart, blockPart, buffer []byte
 	var err error
@@ -239,7 +344,7 @@ func (sum *SpamSum) Scan(state fmt.ScanState, verb rune) error {
 
 	if blocksize, err = strconv.Atoi(string(blockPart)); err != nil {
 		return err
-	} else if blocksize < 3 {
+	} else if blocksize < int(params.MinBlockSize) {
 		return errors.New("Block size too small")
 	}
 
@@ -254,7 +359,7 @@ func (sum *SpamSum) Scan(state fmt.ScanState, verb rune) error {
 			return (bytes.IndexRune([]byte(b64), r) != -1)
 		}); err != nil {
 		return err
-	} else if len(buffer) > SpamsumLength {
+	} else if len(buffer) > params.SignatureLength {
 		return errors.New("First base64 string too long")
 	}
 
@@ -272,16 +377,18 @@ func (sum *SpamSum) Scan(state fmt.ScanState, verb rune) error {
 			return (bytes.IndexRune([]byte(b64), r) != -1)
 		}); err != nil {
 		return err
-	} else if len(buffer) > (SpamsumLength / 2) {
+	} else if len(buffer) > params.SignatureLength {
 		return errors.New("Second base64 string too long")
 	}
 
 	rightPart = make([]byte, len(buffer))
 	copy(rightPart[:], buffer)
 
+	sum.options.NoTruncate = len(rightPart) > params.SignatureLength/2
+	sum.reset()
 	sum.blocksize = uint32(blocksize)
-	copy(sum.leftPart[:], leftPart)
-	copy(sum.rightPart[:], rightPart)
+	copy(sum.leftPart, leftPart)
+	copy(sum.rightPart, rightPart)
 	sum.leftIndex = len(leftPart)
 	sum.rightIndex = len(rightPart)
 
@@ -0,0 +1,152 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// RollingHash is the rolling hash spamsum uses to decide where
+// blocks end.  It combines an Adler-like sum over the last few bytes
+// with a shift/xor hash, so its value depends only on the most recent
+// bytes, and boundaries resynchronise after an insertion or deletion.
+// The zero value is ready to use, and looks at the last seven bytes.
+type RollingHash struct {
+	window                              []byte
+	rollingSum, h2, shiftHash, position uint32
+}
+
+// NewRollingHash returns a RollingHash looking at the last window
+// bytes.  A window of less than one byte is taken to be one byte.
+func NewRollingHash(window int) *RollingHash {
+	if window < 1 {
+		window = 1
+	}
+	return &RollingHash{window: make([]byte, window)}
+}
+
+// Roll adds c to the window, and returns the updated hash value.
+func (rh *RollingHash) Roll(c byte) uint32 {
+	if rh.window == nil {
+		rh.window = make([]byte, rollingWindow)
+	}
+	size := uint32(len(rh.window))
+
+	rh.h2 -= rh.rollingSum
+	rh.h2 += size * uint32(c)
+
+	rh.rollingSum += uint32(c)
+	rh.rollingSum -= uint32(rh.window[rh.position])
+
+	// position is the index of the oldest byte in the window
+	rh.window[rh.position] = c
+	if rh.position++; rh.position == size {
+		rh.position = 0
+	}
+
+	rh.shiftHash <<= 5
+	rh.shiftHash ^= uint32(c)
+
+	return rh.Sum32()
+}
+
+// clone returns a copy of rh that does not share its window.
+func (rh *RollingHash) clone() RollingHash {
+	clone := *rh
+	if rh.window != nil {
+		clone.window = append([]byte(nil), rh.window...)
+	}
+	return clone
+}
+
+// Sum32 returns the current hash value.
+func (rh *RollingHash) Sum32() uint32 {
+	return rh.rollingSum + rh.h2 + rh.shiftHash
+}
+
+// Reset empties the window.
+func (rh *RollingHash) Reset() {
+	for i := range rh.window {
+		rh.window[i] = 0
+	}
+
+	rh.rollingSum = 0
+	rh.h2 = 0
+	rh.shiftHash = 0
+	rh.position = 0
+}
+
+// A Chunk is one content-defined piece of the input of a Chunker.
+// Hash is the FNV-1 hash of Data, using the same starting value as
+// the block hashes in a SpamSum.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+	Hash   uint32
+}
+
+// Chunker splits a stream into chunks at the trigger points of a
+// RollingHash, the same way spamsum splits its input into blocks.
+type Chunker struct {
+	reader           *bufio.Reader
+	minSize, maxSize int
+	trigger          uint32
+	offset           int64
+	rolling          RollingHash
+}
+
+// NewChunker returns a Chunker reading from source.  Chunks are never
+// shorter than minSize or longer than maxSize bytes, except for the
+// last one, and are averageSize bytes long on average when maxSize
+// does not interfere.
+func NewChunker(source io.Reader, minSize, averageSize, maxSize int) (*Chunker, error) {
+	if minSize < 0 || averageSize <= minSize || maxSize < averageSize {
+		return nil, errors.New("Chunk sizes must satisfy 0 <= min < average <= max")
+	}
+
+	return &Chunker{
+		reader:  bufio.NewReaderSize(source, ReadSize),
+		minSize: minSize,
+		maxSize: maxSize,
+		trigger: uint32(averageSize - minSize),
+	}, nil
+}
+
+// Next returns the next chunk.  After the last chunk, it returns
+// io.EOF.  Any other errors returned will originate from the
+// underlying io.Reader.
+func (c *Chunker) Next() (Chunk, error) {
+	chunk := Chunk{Offset: c.offset, Hash: offset32}
+	data := make([]byte, 0, c.minSize+int(c.trigger))
+	c.rolling.Reset()
+
+	for len(data) < c.maxSize {
+		b, err := c.reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Chunk{}, err
+		}
+
+		data = append(data, b)
+		chunk.Hash *= prime32
+		chunk.Hash ^= uint32(b)
+
+		roll := c.rolling.Roll(b)
+		if len(data) >= c.minSize && roll%c.trigger == c.trigger-1 {
+			break
+		}
+	}
+
+	if len(data) == 0 {
+		return Chunk{}, io.EOF
+	}
+
+	chunk.Data = data
+	c.offset += int64(len(data))
+	return chunk, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func chunkAll(t *testing.T, data []byte, minSize, averageSize, maxSize int) []Chunk {
+	chunker, err := NewChunker(bytes.NewReader(data), minSize, averageSize, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := make([]Chunk, 0)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestRollingHashMatchesProcessBlock(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(77)).Read(data)
+
+	var rh RollingHash
+	var sss spamsumState
+	sss.init(DefaultParams)
+	sum := defaultHasher.newSum()
+	sum.blocksize = 48
+
+	for i, c := range data {
+		processBlock(data[i:i+1], 1, &sss, sum)
+		if roll := rh.Roll(c); roll != sss.rolling.Sum32() {
+			t.Fatalf("Rolling hash differs from processBlock at byte %d", i)
+		}
+	}
+}
+
+func TestNewRollingHashWindow(t *testing.T) {
+	for _, window := range []int{0, -1} {
+		rh, one := NewRollingHash(window), NewRollingHash(1)
+		for _, c := range []byte("The quick brown fox") {
+			if rh.Roll(c) != one.Roll(c) {
+				t.Fatalf("A window of %d should act as a window of 1", window)
+			}
+		}
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 1<<18)
+	rand.New(rand.NewSource(1703)).Read(data)
+	minSize, averageSize, maxSize := 512, 2048, 8192
+
+	chunks := chunkAll(t, data, minSize, averageSize, maxSize)
+
+	var joined []byte
+	for i, chunk := range chunks {
+		if chunk.Offset != int64(len(joined)) {
+			t.Errorf("Chunk %d at offset %d should start at %d", i, chunk.Offset, len(joined))
+		}
+		if len(chunk.Data) > maxSize ||
+			(len(chunk.Data) < minSize && i != len(chunks)-1) {
+			t.Errorf("Chunk %d has length %d, outside [%d, %d]", i, len(chunk.Data), minSize, maxSize)
+		}
+
+		hash := offset32
+		for _, c := range chunk.Data {
+			hash = (hash * prime32) ^ uint32(c)
+		}
+		if hash != chunk.Hash {
+			t.Errorf("Chunk %d has hash %x, should be %x", i, chunk.Hash, hash)
+		}
+		joined = append(joined, chunk.Data...)
+	}
+
+	if !bytes.Equal(joined, data) {
+		t.Errorf("Chunks do not add up to the input")
+	}
+
+	average := len(data) / len(chunks)
+	if average < averageSize/2 || average > averageSize*2 {
+		t.Errorf("Average chunk length is %d, expected about %d", average, averageSize)
+	}
+}
+
+func TestChunkerResynchronises(t *testing.T) {
+	data := make([]byte, 1<<16)
+	rand.New(rand.NewSource(4441)).Read(data)
+	edited := append([]byte("a few inserted bytes"), data...)
+
+	original := make(map[uint32]bool)
+	for _, chunk := range chunkAll(t, data, 64, 512, 4096) {
+		original[chunk.Hash] = true
+	}
+
+	shared := 0
+	chunks := chunkAll(t, edited, 64, 512, 4096)
+	for _, chunk := range chunks {
+		if original[chunk.Hash] {
+			shared++
+		}
+	}
+
+	if shared < len(chunks)-2 {
+		t.Errorf("Only %d of %d chunks survive an insertion at the start", shared, len(chunks))
+	}
+}
+
+func TestNewChunkerSizes(t *testing.T) {
+	tests := []struct {
+		minSize, averageSize, maxSize int
+	}{
+		{-1, 10, 20},
+		{10, 10, 20},
+		{5, 10, 9},
+	}
+
+	for _, test := range tests {
+		if _, err := NewChunker(bytes.NewReader(nil), test.minSize, test.averageSize, test.maxSize); err == nil {
+			t.Errorf("Chunk sizes %v should be refused", test)
+		}
+	}
+}
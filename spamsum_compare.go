@@ -16,57 +16,102 @@ const (
 
 // Compare two SpamSums, returning a value between 0 and 100.
 // This method is currently not bug-for-bug compatible with the
-// original spamsum.
+// original spamsum.  SpamSums made with different Params always
+// score 0.
 func (from SpamSum) Compare(to SpamSum) (similarity uint32) {
+	params := from.parameters()
+	for _, pair := range comparableParts(&from, &to) {
+		similarity = uint32(max(int(similarity),
+			score(pair.from, pair.to, pair.capBlocksize, params)))
+	}
+	return
+}
+
+// partPair is a pair of digest halves that Compare scores against
+// each other.  blocksize is the block size both halves were hashed
+// with, capBlocksize the one used to cap the score.
+type partPair struct {
+	from, to     []byte
+	blocksize    uint32
+	capBlocksize int
+}
+
+// comparableParts returns the pairs of digest halves Compare scores.
+// Sums are only comparable if they were made with the same Params,
+// and their block sizes are equal, or differ by a factor of two.
+func comparableParts(from, to *SpamSum) []partPair {
+	if from.parameters() != to.parameters() {
+		return nil
+	}
+
 	q := float32(from.blocksize) / float32(to.blocksize)
 	if q == 1 {
-		similarity = uint32(max(
-			score(from.leftPart[:from.leftIndex],
+		fromRight, toRight := alignTruncation(from.rightPart[:from.rightIndex],
+			to.rightPart[:to.rightIndex], from.parameters())
+		// the second halves have always been capped using the
+		// block size of the first halves.
+		return []partPair{
+			{from.leftPart[:from.leftIndex],
 				to.leftPart[:to.leftIndex],
-				int(from.blocksize)),
-			score(from.rightPart[:from.rightIndex],
-				to.rightPart[:to.rightIndex],
-				int(to.blocksize))))
-
+				from.blocksize, int(from.blocksize)},
+			{fromRight, toRight,
+				from.blocksize * 2, int(to.blocksize)}}
 	} else if q == 2 {
-		similarity = uint32(score(
-			from.leftPart[:from.leftIndex],
-			to.rightPart[:to.rightIndex],
-			int(from.blocksize)))
+		return []partPair{
+			{from.leftPart[:from.leftIndex],
+				to.rightPart[:to.rightIndex],
+				from.blocksize, int(from.blocksize)}}
 	} else if q == 0.5 {
-		similarity = uint32(score(
-			from.rightPart[:from.rightIndex],
-			to.leftPart[:to.leftIndex],
-			int(to.blocksize)))
-	} else {
-		similarity = 0
+		return []partPair{
+			{from.rightPart[:from.rightIndex],
+				to.leftPart[:to.leftIndex],
+				to.blocksize, int(to.blocksize)}}
 	}
-	return
+	return nil
 }
 
-func score(from, to []byte, blocksize int) (score int) {
-	if !hasCommonSubstring(from, to) {
+func score(from, to []byte, blocksize int, params Params) (score int) {
+	if !hasCommonSubstring(from, to, params.Window) {
 		return 0
 	}
 
+	return ungatedScore(from, to, blocksize, params)
+}
+
+// ungatedScore is score without the common substring test.
+func ungatedScore(from, to []byte, blocksize int, params Params) (score int) {
 	from = eliminateRepetition(from)
 	to = eliminateRepetition(to)
 
-	score = editDistance(from, to)
+	if len(from)+len(to) == 0 {
+		return 0
+	}
+
+	score = distanceScore(editDistance(from, to), len(from), len(to), params)
+	return min(score, scoreCap(blocksize, len(from), len(to), params))
+}
 
-	score *= SpamsumLength
-	score /= len(from) + len(to)
+// distanceScore scales the edit distance between two digest halves
+// of length fl and tl to a score between 0 and 100.
+func distanceScore(distance, fl, tl int, params Params) (score int) {
+	score = distance
 
-	score = (score * 100) / 64
+	score *= params.SignatureLength
+	score /= fl + tl
 
-	score = 100 - score
+	score = (score * 100) / params.SignatureLength
 
-	maxscore := blocksize / minBlockSize * min(len(from), len(to))
-	score = min(score, maxscore)
+	score = 100 - score
 
 	return score
 }
 
+// scoreCap limits the score of short digests at small block sizes,
+// where coincidental matches are likely.
+func scoreCap(blocksize, fl, tl int, params Params) int {
+	return blocksize / int(params.MinBlockSize) * min(fl, tl)
+}
+
 func editDistance(from, to []byte) int {
 	// memoize turns a recursive levenshtein function into one that uses an
 	// array to cache results.  Uses |from| * |to| ints of memory.
@@ -130,6 +175,10 @@ func editDistance(from, to []byte) int {
 // longer than 3 bytes to length 3.
 func eliminateRepetition(from []byte) (to []byte) {
 	to = make([]byte, len(from))
+	if len(from) < 3 {
+		copy(to, from)
+		return to
+	}
 	copy(to, from[:3])
 
 	i, j := 3, 3
@@ -146,16 +195,16 @@ func eliminateRepetition(from []byte) (to []byte) {
 }
 
 // hasCommonSubstring returns true if the two byte slices
-// passed have a common substring of at least seven bytes.
-func hasCommonSubstring(seq1, seq2 []byte) (found bool) {
+// passed have a common substring of at least length bytes.
+func hasCommonSubstring(seq1, seq2 []byte, length int) (found bool) {
 shift_offset:
-	for shift := len(seq1) - 7; shift >= 7-len(seq2); shift-- {
+	for shift := len(seq1) - length; shift >= length-len(seq2); shift-- {
 		firstbound, secondbound := max(0, shift), max(0, -shift)
 		common := 0
 		for i, j := firstbound, secondbound; j < len(seq2) && i < len(seq1); i++ {
 			if seq1[i] != seq2[j] {
 				common = 0
-			} else if common == 6 {
+			} else if common == length-1 {
 				found = true
 				break shift_offset
 			} else {
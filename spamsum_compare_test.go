@@ -16,6 +16,8 @@ func TestEliminateRepetition(t *testing.T) {
 		{"AAAABC", "AAABC"},
 		{"Qddddddddd", "Qddd"},
 		{"AtrU||||v*****pn", "AtrU|||v***pn"},
+		{"ZZ", "ZZ"},
+		{"", ""},
 	}
 
 	for _, pair := range teststrings {
@@ -40,7 +42,7 @@ func TestHasCommonSubstring(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		result := hasCommonSubstring([]byte(test.left), []byte(test.right))
+		result := hasCommonSubstring([]byte(test.left), []byte(test.right), rollingWindow)
 		if result != test.expected {
 			condition := "not "
 			if test.expected {
@@ -48,7 +50,7 @@ func TestHasCommonSubstring(t *testing.T) {
 			}
 			t.Errorf("\"%v\" and \"%v\" should %shave a common substring of length 7", test.left, test.right, condition)
 		}
-		mirroredResult := hasCommonSubstring([]byte(test.right), []byte(test.left))
+		mirroredResult := hasCommonSubstring([]byte(test.right), []byte(test.left), rollingWindow)
 		if mirroredResult != result {
 			t.Errorf("Symmetry error for %v and %v", test.left, test.right)
 		}
@@ -106,7 +108,7 @@ func TestScore(t *testing.T) {
 			"xLnWHH6d/4H/4HHHHHHHH4CnrJuN0QhsSyjTU9/j4hbp96khuYhwX", 24, 43},
 	}
 	for _, test := range tests {
-		result := score([]byte(test.left), []byte(test.right), test.blocksize)
+		result := score([]byte(test.left), []byte(test.right), test.blocksize, DefaultParams)
 		if result != test.score_expected {
 			t.Errorf("\"%v\" and \"%v\" should have a score of %d, was %d", test.left, test.right, test.score_expected, result)
 		}
@@ -0,0 +1,87 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+// Containment scores, between 0 and 100, how well needle is contained
+// in haystack.  Unlike Compare, it is not symmetrical: haystack may
+// contain any amount of data before and after the part that resembles
+// needle without lowering the score.  The score is that which Compare
+// would give needle and the best matching stretch of haystack's
+// digest.  The same block size rules as for Compare apply.
+func Containment(needle, haystack SpamSum) (similarity uint32) {
+	params := needle.parameters()
+	for _, pair := range comparableParts(&needle, &haystack) {
+		similarity = uint32(max(int(similarity),
+			containmentScore(pair.from, pair.to, pair.capBlocksize, params)))
+	}
+	return
+}
+
+func containmentScore(needle, haystack []byte, blocksize int, params Params) (score int) {
+	if !hasCommonSubstring(needle, haystack, params.Window) {
+		return 0
+	}
+
+	needle = eliminateRepetition(needle)
+	haystack = eliminateRepetition(haystack)
+
+	for _, alignment := range localAlignments(needle, haystack) {
+		width := alignment.end - alignment.start
+		if width == 0 {
+			continue
+		}
+		s := distanceScore(alignment.distance, len(needle), width, params)
+		score = max(score, min(s, scoreCap(blocksize, len(needle), width, params)))
+	}
+	return score
+}
+
+// localAlignment is the cheapest way to turn needle into
+// haystack[start:end], for one particular end.
+type localAlignment struct {
+	start, end, distance int
+}
+
+// localAlignments returns, for every end offset in haystack, the
+// cheapest alignment of all of needle with a stretch of haystack
+// ending there.  Skipping haystack bytes before the start or after
+// the end is free; the costs are otherwise those of editDistance.
+func localAlignments(needle, haystack []byte) []localAlignment {
+	hl := len(haystack)
+
+	// previous and current rows of the distance table, and the
+	// haystack offset at which each cell's alignment starts.
+	prev, cur := make([]int, hl+1), make([]int, hl+1)
+	prevStart, curStart := make([]int, hl+1), make([]int, hl+1)
+	for j := range prevStart {
+		prevStart[j] = j
+	}
+
+	for i := 1; i <= len(needle); i++ {
+		cur[0], curStart[0] = i*delCost, 0
+		for j := 1; j <= hl; j++ {
+			cost := changeCost
+			if needle[i-1] == haystack[j-1] {
+				cost = 0
+			}
+
+			cur[j], curStart[j] = prev[j-1]+cost, prevStart[j-1]
+			if d := prev[j] + delCost; d < cur[j] {
+				cur[j], curStart[j] = d, prevStart[j]
+			}
+			if d := cur[j-1] + insCost; d < cur[j] {
+				cur[j], curStart[j] = d, curStart[j-1]
+			}
+		}
+		prev, cur = cur, prev
+		prevStart, curStart = curStart, prevStart
+	}
+
+	alignments := make([]localAlignment, hl+1)
+	for j := range alignments {
+		alignments[j] = localAlignment{prevStart[j], j, prev[j]}
+	}
+	return alignments
+}
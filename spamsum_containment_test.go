@@ -0,0 +1,95 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fixedSum(blocksize uint32, parts ...[]byte) *SpamSum {
+	writer := StartFixedBlocksize(blocksize)
+	for _, part := range parts {
+		writer.Write(part)
+	}
+	writeTail(&writer.spamsumState, &writer.SpamSum)
+	sum := writer.SpamSum.clone()
+	return &sum
+}
+
+func TestContainment(t *testing.T) {
+	known, err := os.ReadFile(filepath.Join("testdata", "embedded_video_quicktime.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generator := rand.New(rand.NewSource(1618))
+	before, after, unrelated := make([]byte, 3000), make([]byte, 4000), make([]byte, 26624)
+	generator.Read(before)
+	generator.Read(after)
+	generator.Read(unrelated)
+
+	// hashed at the same block size, so the needle's digest
+	// appears in the middle of the haystack's.
+	needle := fixedSum(96, known[:8000])
+	haystack := fixedSum(96, before, known[:8000], after)
+
+	contained := Containment(*needle, *haystack)
+	if contained < 90 {
+		t.Errorf("%v should be contained in %v, scored %d", needle, haystack, contained)
+	}
+	if compared := needle.Compare(*haystack); compared >= contained {
+		t.Errorf("Compare scores %d, should be below containment score %d", compared, contained)
+	}
+	if reverse := Containment(*haystack, *needle); reverse >= contained {
+		t.Errorf("The haystack should not be contained in the needle, scored %d", reverse)
+	}
+
+	if score := Containment(*needle, *fixedSum(96, unrelated)); score != 0 {
+		t.Errorf("Unrelated data should not contain the needle, scored %d", score)
+	}
+	if score := Containment(*needle, *fixedSum(768, before, known, after)); score != 0 {
+		t.Errorf("Incompatible block sizes should score 0, scored %d", score)
+	}
+}
+
+func TestContainmentOfItself(t *testing.T) {
+	for _, input := range []string{
+		"12582912:kVxeXup8VuH8rD//4crHBrlGXm5WgYJ70A:e4XuptH8D//4crHMmUfL",
+		"48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs",
+	} {
+		var sum SpamSum
+		fmt.Sscan(input, &sum)
+		if score, compared := Containment(sum, sum), sum.Compare(sum); score != compared {
+			t.Errorf("%s contains itself with score %d, compares with %d", input, score, compared)
+		}
+	}
+}
+
+func TestLocalAlignments(t *testing.T) {
+	tests := []struct {
+		needle, haystack string
+		start, end, dist int
+	}{
+		{"abcdefg", "xxabcdefgyy", 2, 9, 0},
+		{"abcdefg", "abcqefg", 0, 7, 2},
+		{"abc", "", 0, 0, 3},
+	}
+
+	for _, test := range tests {
+		best := localAlignment{distance: -1}
+		for _, a := range localAlignments([]byte(test.needle), []byte(test.haystack)) {
+			if best.distance < 0 || a.distance < best.distance {
+				best = a
+			}
+		}
+		if best != (localAlignment{test.start, test.end, test.dist}) {
+			t.Errorf("Best alignment of %s in %s is %v", test.needle, test.haystack, best)
+		}
+	}
+}
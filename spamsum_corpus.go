@@ -0,0 +1,206 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A Corpus records, for every substring of Window characters (a
+// gram), how many of the SpamSums added to it contain that gram.
+// Grams shared by many digests usually come from common file headers
+// or mail templates, and say little about whether two inputs are
+// related; CompareWeighted uses a Corpus to discount them.
+type Corpus struct {
+	params    Params
+	documents int
+	frequency map[string]int
+}
+
+// NewCorpus returns an empty Corpus for SpamSums made with the default
+// parameters.
+func NewCorpus() *Corpus {
+	return defaultHasher.NewCorpus()
+}
+
+// NewCorpus returns an empty Corpus for SpamSums made with the
+// parameters of the Hasher.
+func (h *Hasher) NewCorpus() *Corpus {
+	return &Corpus{params: h.params, frequency: make(map[string]int)}
+}
+
+// grams returns the distinct grams in both halves of sum.
+func (c *Corpus) grams(sum *SpamSum) map[string]bool {
+	grams := make(map[string]bool)
+	for _, half := range [][]byte{sum.leftPart[:sum.leftIndex], sum.rightPart[:sum.rightIndex]} {
+		for i := 0; i+c.params.Window <= len(half); i++ {
+			grams[string(half[i:i+c.params.Window])] = true
+		}
+	}
+	return grams
+}
+
+// Add counts the grams of sum.  A gram occurring several times in one
+// SpamSum is counted once.  Returns ErrParamsMismatch if sum was made
+// with other parameters than the Corpus.
+func (c *Corpus) Add(sum *SpamSum) error {
+	if sum.parameters() != c.params {
+		return ErrParamsMismatch
+	}
+
+	c.documents++
+	for gram := range c.grams(sum) {
+		c.frequency[gram]++
+	}
+	return nil
+}
+
+// Documents returns the number of SpamSums added to the Corpus.
+func (c *Corpus) Documents() int {
+	return c.documents
+}
+
+// DocumentFrequency returns the fraction of SpamSums in the Corpus
+// that contain gram.
+func (c *Corpus) DocumentFrequency(gram string) float64 {
+	if c.documents == 0 {
+		return 0
+	}
+	return float64(c.frequency[gram]) / float64(c.documents)
+}
+
+// CompareWeighted compares two SpamSums like Compare, but ignores all
+// grams that occur in more than maxFrequency (a fraction between 0 and
+// 1) of the SpamSums in corpus.  Such grams do not count towards the
+// common substring test, and the characters they cover are removed
+// from both digests before the edit distance is taken.
+func CompareWeighted(from, to SpamSum, corpus *Corpus, maxFrequency float64) (similarity uint32) {
+	if from.parameters() != corpus.params {
+		return 0
+	}
+
+	for _, pair := range comparableParts(&from, &to) {
+		similarity = uint32(max(int(similarity),
+			corpus.score(pair.from, pair.to, pair.capBlocksize, maxFrequency)))
+	}
+	return
+}
+
+func (c *Corpus) score(from, to []byte, blocksize int, maxFrequency float64) int {
+	window := c.params.Window
+	grams := make(map[string]bool)
+	for i := 0; i+window <= len(to); i++ {
+		grams[string(to[i:i+window])] = true
+	}
+
+	// the grams both digests share, split by frequency
+	frequent := make(map[string]bool)
+	gate := false
+	for i := 0; i+window <= len(from); i++ {
+		gram := string(from[i : i+window])
+		if !grams[gram] {
+			continue
+		} else if c.DocumentFrequency(gram) > maxFrequency {
+			frequent[gram] = true
+		} else {
+			gate = true
+		}
+	}
+
+	if !gate {
+		return 0
+	}
+
+	return ungatedScore(c.strip(from, frequent), c.strip(to, frequent), blocksize, c.params)
+}
+
+// strip removes all characters covered by any of grams from digest.
+func (c *Corpus) strip(digest []byte, grams map[string]bool) []byte {
+	window := c.params.Window
+	covered := make([]bool, len(digest))
+	for i := 0; i+window <= len(digest); i++ {
+		if grams[string(digest[i:i+window])] {
+			for j := i; j < i+window; j++ {
+				covered[j] = true
+			}
+		}
+	}
+
+	stripped := make([]byte, 0, len(digest))
+	for i, char := range digest {
+		if !covered[i] {
+			stripped = append(stripped, char)
+		}
+	}
+	return stripped
+}
+
+const corpusHeader = "spamsum-corpus"
+
+// WriteTo writes the Corpus to w, in a line-oriented text format that
+// ReadCorpus reads back.  The first line holds the parameters and the
+// number of documents, each following line the number of documents
+// containing a gram, and the gram.  Grams are sorted, so equal
+// corpora produce identical output.
+func (c *Corpus) WriteTo(w io.Writer) (int64, error) {
+	grams := make([]string, 0, len(c.frequency))
+	for gram := range c.frequency {
+		grams = append(grams, gram)
+	}
+	sort.Strings(grams)
+
+	var written int64
+	writer := bufio.NewWriter(w)
+	count := func(n int, err error) error {
+		written += int64(n)
+		return err
+	}
+
+	if err := count(fmt.Fprintf(writer, "%s %d %d %d %d\n", corpusHeader,
+		c.params.SignatureLength, c.params.Window, c.params.MinBlockSize,
+		c.documents)); err != nil {
+		return written, err
+	}
+	for _, gram := range grams {
+		if err := count(fmt.Fprintf(writer, "%d %s\n", c.frequency[gram], gram)); err != nil {
+			return written, err
+		}
+	}
+	return written, writer.Flush()
+}
+
+// ReadCorpus reads a Corpus written by WriteTo.
+func ReadCorpus(r io.Reader) (*Corpus, error) {
+	reader := bufio.NewReader(r)
+
+	var header string
+	c := &Corpus{frequency: make(map[string]int)}
+	if _, err := fmt.Fscanf(reader, "%s %d %d %d %d\n", &header,
+		&c.params.SignatureLength, &c.params.Window, &c.params.MinBlockSize,
+		&c.documents); err != nil {
+		return nil, err
+	} else if header != corpusHeader {
+		return nil, errors.New("Not a spamsum corpus")
+	} else if err := c.params.validate(); err != nil {
+		return nil, err
+	}
+
+	for {
+		var count int
+		var gram string
+		if _, err := fmt.Fscanf(reader, "%d %s\n", &count, &gram); err == io.EOF {
+			return c, nil
+		} else if err != nil {
+			return nil, err
+		} else if len(gram) != c.params.Window || count < 1 || count > c.documents {
+			return nil, fmt.Errorf("Invalid corpus entry %d %s", count, gram)
+		}
+		c.frequency[gram] = count
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// boilerplateSums returns n sums of inputs consisting of a shared
+// header followed by random data.
+func boilerplateSums(n int) (sums []*SpamSum, header []byte) {
+	generator := rand.New(rand.NewSource(2718))
+	header = make([]byte, 3000)
+	generator.Read(header)
+
+	for i := 0; i < n; i++ {
+		body := make([]byte, 2000)
+		generator.Read(body)
+		sums = append(sums, fixedSum(96, header, body))
+	}
+	return sums, header
+}
+
+func TestCompareWeighted(t *testing.T) {
+	sums, header := boilerplateSums(40)
+	corpus := NewCorpus()
+	for _, sum := range sums {
+		if err := corpus.Add(sum); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unrelated := sums[0].Compare(*sums[1])
+	if unrelated < 50 {
+		t.Fatalf("Sums sharing a header should compare well, scored %d", unrelated)
+	}
+	if weighted := CompareWeighted(*sums[0], *sums[1], corpus, 0.5); weighted != 0 {
+		t.Errorf("Sums sharing only a common header should score 0, scored %d", weighted)
+	}
+	if weighted := CompareWeighted(*sums[0], *sums[1], corpus, 1); weighted != unrelated {
+		t.Errorf("With a maximum frequency of 1, scores should be unchanged, got %d", weighted)
+	}
+
+	// a copy of one of the inputs, with a small edit in its body
+	body := make([]byte, 2000)
+	rand.New(rand.NewSource(1)).Read(body)
+	original := fixedSum(96, header, body)
+	copy(body[1000:], "edited")
+	edited := fixedSum(96, header, body)
+
+	if weighted := CompareWeighted(*original, *edited, corpus, 0.5); weighted < 50 {
+		t.Errorf("Related sums should still match, scored %d", weighted)
+	}
+}
+
+func TestCorpusSerialization(t *testing.T) {
+	sums, _ := boilerplateSums(10)
+	corpus := NewCorpus()
+	for _, sum := range sums {
+		corpus.Add(sum)
+	}
+
+	var buffer bytes.Buffer
+	written, err := corpus.WriteTo(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buffer.Len()) {
+		t.Errorf("WriteTo reports %d bytes, wrote %d", written, buffer.Len())
+	}
+	serialized := buffer.String()
+
+	read, err := ReadCorpus(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Documents() != corpus.Documents() || len(read.frequency) != len(corpus.frequency) {
+		t.Errorf("Read corpus has %d documents and %d grams, should be %d and %d",
+			read.Documents(), len(read.frequency), corpus.Documents(), len(corpus.frequency))
+	}
+	for gram := range corpus.frequency {
+		if read.DocumentFrequency(gram) != corpus.DocumentFrequency(gram) {
+			t.Errorf("Frequency of %s changed from %f to %f", gram,
+				corpus.DocumentFrequency(gram), read.DocumentFrequency(gram))
+		}
+	}
+
+	buffer.Reset()
+	read.WriteTo(&buffer)
+	if buffer.String() != serialized {
+		t.Errorf("Serialization is not stable")
+	}
+
+	for _, invalid := range []string{
+		"",
+		"not-a-corpus 64 7 3 1\n",
+		"spamsum-corpus 64 7 3 1\n2 ABCDEFG\n",
+		"spamsum-corpus 64 7 3 1\n1 ABCDEF\n",
+	} {
+		if _, err := ReadCorpus(bytes.NewBufferString(invalid)); err == nil {
+			t.Errorf("%q should not be read as a corpus", invalid)
+		}
+	}
+}
+
+func TestCorpusParams(t *testing.T) {
+	hasher, err := NewHasher(Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCorpus().Add(hasher.HashBytes([]byte("some data"))); err != ErrParamsMismatch {
+		t.Errorf("Adding a sum with other parameters should fail, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// A FileDigest combines the SpamSum of an input with its exact size
+// in bytes, and any number of named cryptographic digests of the
+// same input, such as "md5" or "sha256".
+type FileDigest struct {
+	Sum     *SpamSum
+	Size    int64
+	Digests map[string][]byte
+}
+
+// Hex returns the named digest in lowercase hexadecimal, or the empty
+// string if it was not computed.
+func (fd *FileDigest) Hex(name string) string {
+	if digest, ok := fd.Digests[name]; ok {
+		return hex.EncodeToString(digest)
+	}
+	return ""
+}
+
+// byteCounter is an io.Writer that counts, and discards, its input.
+type byteCounter int64
+
+func (bc *byteCounter) Write(b []byte) (int, error) {
+	*bc += byteCounter(len(b))
+	return len(b), nil
+}
+
+// digestWriters returns a writer feeding all hashes, and counting the
+// bytes written in size.
+func digestWriters(hashes map[string]hash.Hash, size *byteCounter) io.Writer {
+	writers := []io.Writer{size}
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	return io.MultiWriter(writers...)
+}
+
+func sumDigests(hashes map[string]hash.Hash) map[string][]byte {
+	digests := make(map[string][]byte, len(hashes))
+	for name, h := range hashes {
+		digests[name] = h.Sum(nil)
+	}
+	return digests
+}
+
+// HashReadSeekerDigests is like HashReadSeeker, but also feeds the
+// data read during the first pass through every hash in hashes, so
+// that cryptographic digests are computed without reading the input
+// again.  The hashes should be freshly created or Reset; they are
+// keyed by the name they will have in the FileDigest.
+func HashReadSeekerDigests(source io.ReadSeeker, length int64, hashes map[string]hash.Hash) (*FileDigest, error) {
+	var size byteCounter
+	sum, err := defaultHasher.hashReadSeeker(source, length, nil, digestWriters(hashes, &size))
+	if err != nil {
+		return nil, err
+	}
+	return &FileDigest{sum, int64(size), sumDigests(hashes)}, nil
+}
+
+// A DigestWriter is a SpamSumWriter that also feeds everything
+// written to it through a set of cryptographic hashes.
+type DigestWriter struct {
+	SpamSumWriter
+	hashes map[string]hash.Hash
+	size   byteCounter
+	tee    io.Writer
+}
+
+// StartFixedBlocksizeDigests is like StartFixedBlocksize, but the
+// resulting writer also feeds its input through every hash in
+// hashes.
+func StartFixedBlocksizeDigests(blockSize uint32, hashes map[string]hash.Hash) *DigestWriter {
+	dw := &DigestWriter{SpamSumWriter: *StartFixedBlocksize(blockSize), hashes: hashes}
+	dw.tee = digestWriters(hashes, &dw.size)
+	return dw
+}
+
+// Write a byte slice to the DigestWriter.  Returns the length of the
+// byte slice, and nil.
+func (dw *DigestWriter) Write(block []byte) (int, error) {
+	dw.tee.Write(block)
+	return dw.SpamSumWriter.Write(block)
+}
+
+// Reset sets the SpamSum, the byte count and all hashes to their
+// initial state.
+func (dw *DigestWriter) Reset() {
+	dw.SpamSumWriter.Reset()
+	dw.size = 0
+	for _, h := range dw.hashes {
+		h.Reset()
+	}
+}
+
+// FileDigest returns the SpamSum, byte count and digests of
+// everything written so far.
+func (dw *DigestWriter) FileDigest() *FileDigest {
+	writeTail(&dw.spamsumState, &dw.SpamSum)
+	sum := dw.SpamSum.clone()
+	sum.countTail()
+	return &FileDigest{&sum, int64(dw.size), sumDigests(dw.hashes)}
+}
@@ -0,0 +1,90 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newHashes() map[string]hash.Hash {
+	return map[string]hash.Hash{
+		"md5":    md5.New(),
+		"sha1":   sha1.New(),
+		"sha256": sha256.New(),
+	}
+}
+
+func TestHashReadSeekerDigests(t *testing.T) {
+	for _, filename := range []string{"LAND.MAP", "embedded_video_quicktime.doc"} {
+		path := filepath.Join("testdata", filename)
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		digest, err := HashReadSeekerDigests(file, int64(len(contents)), newHashes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if digest.Sum.String() != HashBytes(contents).String() {
+			t.Errorf("SpamSum of %s is %v, should be %v", filename, digest.Sum, HashBytes(contents))
+		}
+		if digest.Size != int64(len(contents)) {
+			t.Errorf("Size of %s is %d, should be %d", filename, digest.Size, len(contents))
+		}
+
+		md5sum, sha1sum, sha256sum := md5.Sum(contents), sha1.Sum(contents), sha256.Sum256(contents)
+		for name, expected := range map[string][]byte{
+			"md5": md5sum[:], "sha1": sha1sum[:], "sha256": sha256sum[:],
+		} {
+			if digest.Hex(name) != hex.EncodeToString(expected) {
+				t.Errorf("%s of %s is %s, should be %x", name, filename, digest.Hex(name), expected)
+			}
+		}
+		if digest.Hex("crc32") != "" {
+			t.Errorf("A digest that was not requested should be empty")
+		}
+	}
+}
+
+func TestDigestWriter(t *testing.T) {
+	contents, err := os.ReadFile(filepath.Join("testdata", "embedded_video_quicktime.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := StartFixedBlocksizeDigests(192, newHashes())
+	for i := 0; i < 2; i++ {
+		writer.Write(contents[:1000])
+		writer.Write(contents[1000:])
+
+		digest := writer.FileDigest()
+		expected := sha256.Sum256(contents)
+		if digest.Hex("sha256") != hex.EncodeToString(expected[:]) {
+			t.Errorf("sha256 is %s, should be %x", digest.Hex("sha256"), expected)
+		}
+		if digest.Size != int64(len(contents)) {
+			t.Errorf("Size is %d, should be %d", digest.Size, len(contents))
+		}
+		if digest.Sum.String() != "192:o50PBwxGc+ZrnCe9pz1aZ8GHiLUd0935:G8cOz9pzJ3" {
+			t.Errorf("Unexpected SpamSum %v", digest.Sum)
+		}
+
+		writer.Reset()
+	}
+}
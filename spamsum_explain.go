@@ -0,0 +1,135 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+// An EditOp is one step in turning one digest half into another.
+type EditOp byte
+
+const (
+	EditMatch EditOp = iota
+	EditSubstitute
+	EditInsert
+	EditDelete
+)
+
+func (op EditOp) String() string {
+	switch op {
+	case EditMatch:
+		return "match"
+	case EditSubstitute:
+		return "substitute"
+	case EditInsert:
+		return "insert"
+	case EditDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// A PartComparison explains how Compare scored one pair of digest
+// halves.  From and To are the halves after runs of repeated
+// characters have been shortened, and Script turns From into To.
+type PartComparison struct {
+	BlockSize       uint32
+	From, To        []byte
+	Script          []EditOp
+	CommonSubstring bool
+	Distance        int
+	DistanceScore   int
+	Cap             int
+	Score           uint32
+}
+
+// A Comparison explains the result of Compare.  Score is the highest
+// score of its Parts, and is always equal to what Compare returns.
+type Comparison struct {
+	Parts []PartComparison
+	Score uint32
+}
+
+// Explain compares two SpamSums like Compare does, and returns the
+// intermediate results for every pair of digest halves compared.
+// Sums that Compare considers incomparable produce no Parts.
+func (from SpamSum) Explain(to SpamSum) Comparison {
+	var comparison Comparison
+	params := from.parameters()
+	for _, pair := range comparableParts(&from, &to) {
+		part := PartComparison{
+			BlockSize:       pair.blocksize,
+			From:            eliminateRepetition(pair.from),
+			To:              eliminateRepetition(pair.to),
+			CommonSubstring: hasCommonSubstring(pair.from, pair.to, params.Window),
+		}
+
+		part.Script = editScript(part.From, part.To)
+		part.Distance = editDistance(part.From, part.To)
+		if len(part.From)+len(part.To) > 0 {
+			part.DistanceScore = distanceScore(part.Distance, len(part.From), len(part.To), params)
+		}
+		part.Cap = scoreCap(pair.capBlocksize, len(part.From), len(part.To), params)
+		if part.CommonSubstring {
+			part.Score = uint32(min(part.DistanceScore, part.Cap))
+		}
+
+		comparison.Parts = append(comparison.Parts, part)
+		comparison.Score = uint32(max(int(comparison.Score), int(part.Score)))
+	}
+	return comparison
+}
+
+// editScript returns a cheapest sequence of operations turning from
+// into to, using the same costs as editDistance.  Every EditMatch and
+// EditSubstitute consumes a byte of both slices, every EditDelete a byte
+// of from, and every EditInsert a byte of to.
+func editScript(from, to []byte) []EditOp {
+	fl, tl := len(from), len(to)
+	width := tl + 1
+	table := make([]int, (fl+1)*width)
+
+	for i := 0; i <= fl; i++ {
+		for j := 0; j <= tl; j++ {
+			switch {
+			case i == 0:
+				table[j] = j * insCost
+			case j == 0:
+				table[i*width] = i * delCost
+			default:
+				cost := changeCost
+				if from[i-1] == to[j-1] {
+					cost = 0
+				}
+				table[i*width+j] = min(
+					table[(i-1)*width+j]+delCost,
+					table[i*width+j-1]+insCost,
+					table[(i-1)*width+j-1]+cost)
+			}
+		}
+	}
+
+	script := make([]EditOp, 0, fl+tl)
+	for i, j := fl, tl; i > 0 || j > 0; {
+		here := table[i*width+j]
+		switch {
+		case i > 0 && j > 0 && from[i-1] == to[j-1] &&
+			here == table[(i-1)*width+j-1]:
+			script = append(script, EditMatch)
+			i, j = i-1, j-1
+		case i > 0 && here == table[(i-1)*width+j]+delCost:
+			script = append(script, EditDelete)
+			i--
+		case j > 0 && here == table[i*width+j-1]+insCost:
+			script = append(script, EditInsert)
+			j--
+		default:
+			script = append(script, EditSubstitute)
+			i, j = i-1, j-1
+		}
+	}
+
+	for l, r := 0, len(script)-1; l < r; l, r = l+1, r-1 {
+		script[l], script[r] = script[r], script[l]
+	}
+	return script
+}
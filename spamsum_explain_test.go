@@ -0,0 +1,95 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEditScript(t *testing.T) {
+	tests := []struct {
+		left, right string
+	}{
+		{"abcdefg", "abcdefg"},
+		{"abcdefg", "abcqefg"},
+		{"", "1234567"},
+		{"HIJKLMN", "JKLMNOPQRST"},
+		{"vEnWHH6d/4H/4Z2fvNoF8Sy2yt/YUC",
+			"xLnWHH6d/4H/4HHHHHHHH4CnrJuN0QhsSyjTU9/j4hbp96khuYhwX"},
+	}
+
+	for _, test := range tests {
+		from, to := []byte(test.left), []byte(test.right)
+		cost, i, j := 0, 0, 0
+		for _, op := range editScript(from, to) {
+			switch op {
+			case EditMatch:
+				if from[i] != to[j] {
+					t.Errorf("%s, %s: match of %c and %c", test.left, test.right, from[i], to[j])
+				}
+				i, j = i+1, j+1
+			case EditSubstitute:
+				cost += changeCost
+				i, j = i+1, j+1
+			case EditInsert:
+				cost += insCost
+				j++
+			case EditDelete:
+				cost += delCost
+				i++
+			}
+		}
+
+		if i != len(from) || j != len(to) {
+			t.Errorf("%s, %s: script does not consume both strings", test.left, test.right)
+		}
+		if distance := editDistance(from, to); cost != distance {
+			t.Errorf("%s, %s: script costs %d, edit distance is %d", test.left, test.right, cost, distance)
+		}
+	}
+}
+
+func TestExplainAgreesWithCompare(t *testing.T) {
+	sums := []string{
+		"12582912:UVxeXup8VuH8rD//pcrHBrlG5FWgYJ70A:O4XuptH8D//pcrHmgfL",
+		"12582912:kVxeXup8VuH8rD//4crHBrlGXm5WgYJ70A:e4XuptH8D//4crHMmUfL",
+		"96:aaUi0DTEnLMZMVd2jnEMyFrsdy9LdeGatg3Uogbqs0uBUZoXLn1IvwwDaK:aaf0PU8YMnElrcULdSWgbqs0uBb1IIK",
+		"192:aaf6PU8YMnElrcULdSWgbqs0uBb1IIAfsR6OZWjZDx:aaf6PUcYrfLdSWgms0uBb1TA0lZ8ZDx",
+		"48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs",
+		"48:w+wNj5GLBX/8jrT14EHWFIUXs0hPbaL3qd9hI6h0:w+zLBX/w14EecWT6ad9hs",
+		"24:R9mMhMDnWm8m86dmW4zm8mW4zm/mhkcnZ/uLkcHrBCaDrvNQxhwQmq8SywwboX+6:vEnWHH6d/4H/4Z2fvNoF8Sy2yt/YUC",
+		"48:xLnWHH6d/4H/4HHHHHHHH4CnrJuN0QhsSyjTU9/j4hbp96khuYhwX:NWHH6dQHQHHHHHHHH4CnV1QeSyj8j4hG",
+	}
+
+	for _, left := range sums {
+		for _, right := range sums {
+			var from, to SpamSum
+			fmt.Sscan(left, &from)
+			fmt.Sscan(right, &to)
+
+			comparison := from.Explain(to)
+			if similarity := from.Compare(to); comparison.Score != similarity {
+				t.Errorf("Explain(%s, %s) scores %d, Compare scores %d", left, right, comparison.Score, similarity)
+			}
+
+			for _, part := range comparison.Parts {
+				if len(part.Script) < max(len(part.From), len(part.To)) {
+					t.Errorf("Edit script of %s and %s is too short", part.From, part.To)
+				}
+			}
+		}
+	}
+}
+
+func TestExplainIncomparable(t *testing.T) {
+	var from, to SpamSum
+	fmt.Sscan("3:Bl5KOiWl/:ldZ/", &from)
+	fmt.Sscan("96:aaUi0DTEnLMZMVd2jnEMyFrsdy9LdeGatg3Uogbqs0uBUZoXLn1IvwwDaK:aaf0PU8YMnElrcULdSWgbqs0uBb1IIK", &to)
+
+	if comparison := from.Explain(to); len(comparison.Parts) != 0 || comparison.Score != 0 {
+		t.Errorf("Sums with block sizes 3 and 96 should not be compared, got %v", comparison)
+	}
+}
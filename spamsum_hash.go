@@ -0,0 +1,195 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math"
+)
+
+// digest is the hash.Hash returned by NewHash.
+type digest struct {
+	sum   SpamSum
+	state spamsumState
+}
+
+// NewHash returns a hash.Hash taking the SpamSum of everything
+// written to it, with a fixed block size.  Unlike SpamSumWriter, its
+// Sum appends the binary encoding of the complete SpamSum, parameters
+// included, which DecodeSum turns back into a SpamSum, and its Size
+// and BlockSize have their hash.Hash meaning.  The same caveats about
+// the fixed block size apply as for StartFixedBlocksize.
+func NewHash(blockSize uint32) hash.Hash {
+	return defaultHasher.NewHash(blockSize)
+}
+
+// NewHash is like the package-level NewHash, using the parameters and
+// options of the Hasher.
+func (h *Hasher) NewHash(blockSize uint32) hash.Hash {
+	d := &digest{sum: *h.newSum()}
+	d.sum.blocksize = blockSize
+	d.state.init(h.params)
+	return d
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	processBlock(p, len(p), &d.state, &d.sum)
+	return len(p), nil
+}
+
+// Sum appends the binary encoding of the SpamSum of the data written
+// so far to b.  It does not change the state of the hash.
+func (d *digest) Sum(b []byte) []byte {
+	state := d.state
+	sum := d.sum.clone()
+
+	writeTail(&state, &sum)
+	sum.countTail()
+	if sum.options.EliminateSequences {
+		sum.eliminateSequences()
+	}
+	return sum.appendBinary(b)
+}
+
+func (d *digest) Reset() {
+	d.state.reset()
+	d.sum.reset()
+}
+
+// Size returns the length of the binary encoding, which only
+// depends on the signature length.
+func (d *digest) Size() int {
+	return encodedLength(d.sum.parameters())
+}
+
+// BlockSize returns 1; Write accepts any amount of data equally
+// efficiently.
+func (d *digest) BlockSize() int {
+	return 1
+}
+
+// The binary encoding starts with a version byte and the parameters
+// of the SpamSum: a 2-byte signature length, a 2-byte window and a
+// 4-byte minimum block size.
+const (
+	binaryVersion    = 1
+	binaryHeaderSize = 1 + 2 + 2 + 4
+)
+
+// encodedLength is the length of the binary encoding of SpamSums
+// made with params: the header, a 4-byte block size, and for both
+// halves a 2-byte length followed by the characters, padded with
+// zeroes up to the signature length.
+func encodedLength(params Params) int {
+	return binaryHeaderSize + 4 + 2*(2+params.SignatureLength)
+}
+
+func (sum *SpamSum) appendBinary(b []byte) []byte {
+	params := sum.parameters()
+	b = append(b, binaryVersion)
+	b = binary.BigEndian.AppendUint16(b, uint16(params.SignatureLength))
+	b = binary.BigEndian.AppendUint16(b, uint16(params.Window))
+	b = binary.BigEndian.AppendUint32(b, params.MinBlockSize)
+	b = binary.BigEndian.AppendUint32(b, sum.blocksize)
+	for _, part := range [][]byte{sum.leftPart, sum.rightPart} {
+		length := nonZeroLength(part)
+		b = binary.BigEndian.AppendUint16(b, uint16(length))
+		b = append(b, part[:length]...)
+		b = append(b, make([]byte, params.SignatureLength-length)...)
+	}
+	return b
+}
+
+// MarshalBinary encodes the SpamSum in the form appended by the Sum
+// method of a hash returned by NewHash.
+func (sum *SpamSum) MarshalBinary() ([]byte, error) {
+	if sum.parameters().SignatureLength > math.MaxUint16 {
+		return nil, errors.New("Signature length too large to encode")
+	}
+	return sum.appendBinary(nil), nil
+}
+
+// UnmarshalBinary decodes a SpamSum encoded by MarshalBinary, along
+// with its parameters.  A zero SpamSum takes the parameters of the
+// encoding; any other returns ErrParamsMismatch if they differ from
+// its own.
+func (sum *SpamSum) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryHeaderSize {
+		return errors.New("Encoded SpamSum too short")
+	} else if data[0] != binaryVersion {
+		return errors.New("Unsupported SpamSum encoding version")
+	}
+	params := Params{
+		SignatureLength: int(binary.BigEndian.Uint16(data[1:])),
+		Window:          int(binary.BigEndian.Uint16(data[3:])),
+		MinBlockSize:    binary.BigEndian.Uint32(data[5:]),
+	}
+	if err := params.validate(); err != nil {
+		return err
+	}
+	if sum.params != (Params{}) && sum.params != params {
+		return ErrParamsMismatch
+	}
+	if len(data) != encodedLength(params) {
+		return errors.New("Encoded SpamSum has the wrong length")
+	}
+
+	data = data[binaryHeaderSize:]
+	blocksize := binary.BigEndian.Uint32(data)
+	if blocksize < params.MinBlockSize {
+		return errors.New("Block size too small")
+	}
+
+	parts := make([][]byte, 2)
+	data = data[4:]
+	for i := range parts {
+		length := int(binary.BigEndian.Uint16(data))
+		if length > params.SignatureLength {
+			return errors.New("Encoded base64 string too long")
+		}
+		parts[i] = data[2 : 2+length]
+		for _, c := range parts[i] {
+			if bytes.IndexByte([]byte(b64), c) == -1 {
+				return errors.New("Invalid character in encoded SpamSum")
+			}
+		}
+		data = data[2+params.SignatureLength:]
+	}
+
+	sum.params = params
+	sum.options.NoTruncate = len(parts[1]) > params.SignatureLength/2
+	sum.reset()
+	sum.blocksize = blocksize
+	copy(sum.leftPart, parts[0])
+	copy(sum.rightPart, parts[1])
+	sum.leftIndex = len(parts[0])
+	sum.rightIndex = len(parts[1])
+	return nil
+}
+
+// DecodeSum decodes a SpamSum, with the parameters it was made with,
+// from the output of the Sum method of a hash returned by NewHash, or
+// of MarshalBinary.
+func DecodeSum(b []byte) (*SpamSum, error) {
+	sum := new(SpamSum)
+	if err := sum.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// DecodeSum is like the package-level DecodeSum, returning
+// ErrParamsMismatch for SpamSums not made with the parameters of the
+// Hasher.
+func (h *Hasher) DecodeSum(b []byte) (*SpamSum, error) {
+	sum := &SpamSum{params: h.params}
+	if err := sum.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
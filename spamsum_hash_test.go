@@ -0,0 +1,204 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = new(SpamSum)
+	_ encoding.BinaryUnmarshaler = new(SpamSum)
+)
+
+func TestHash(t *testing.T) {
+	contents, err := os.ReadFile(filepath.Join("testdata", "LAND.MAP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := HashBytes(contents)
+
+	h := NewHash(uint32(expected.BlockSize()))
+	if h.Size() != 9+4+2+SpamsumLength+2+SpamsumLength || h.BlockSize() != 1 {
+		t.Errorf("Unexpected Size %d or BlockSize %d", h.Size(), h.BlockSize())
+	}
+
+	crypto := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h, crypto), bytes.NewReader(contents)); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := []byte("prefix")
+	encoded := h.Sum(prefix)
+	if !bytes.HasPrefix(encoded, prefix) || len(encoded) != len(prefix)+h.Size() {
+		t.Fatalf("Sum should append %d bytes, got %d", h.Size(), len(encoded)-len(prefix))
+	}
+	if !bytes.Equal(encoded[len(prefix):], h.Sum(nil)) {
+		t.Error("Sum should not change the state of the hash")
+	}
+
+	decoded, err := DecodeSum(encoded[len(prefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != expected.String() {
+		t.Errorf("Decoded %v, expected %v", decoded, expected)
+	}
+
+	h.Reset()
+	h.Write(contents)
+	if !bytes.Equal(h.Sum(nil), encoded[len(prefix):]) {
+		t.Error("Reset hash produces a different Sum")
+	}
+}
+
+func TestHashInterface(t *testing.T) {
+	// generic code should be able to treat it like any other hash
+	for _, h := range []hash.Hash{NewHash(48), sha256.New()} {
+		h.Write([]byte("The quick brown fox jumps over the lazy dog"))
+		if len(h.Sum(nil)) != h.Size() {
+			t.Errorf("%T: Sum has %d bytes, Size is %d", h, len(h.Sum(nil)), h.Size())
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	for _, s := range []string{
+		"3::",
+		"48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs",
+		"3072:xSEnWDohs7vqB8A911BemXKwaZqwhs2MoBp1crX5YkGa9HkHs3WuVfYBoPXBwtB3:aF7jA1BFXvaZhe2M61crX5Ykz12LWmoPXBOiswfXGh/nkdoj",
+	} {
+		var sum SpamSum
+		if _, err := fmt.Sscan(s, &sum); err != nil {
+			t.Fatal(err)
+		}
+		data, err := sum.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded SpamSum
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.String() != s || decoded.Compare(sum) != sum.Compare(sum) {
+			t.Errorf("%s decoded as %v", s, &decoded)
+		}
+	}
+}
+
+func TestBinaryParams(t *testing.T) {
+	params := Params{SignatureLength: 128, Window: 5, MinBlockSize: 6}
+	hasher, _ := NewHasher(params)
+	sum := hasher.HashBytes([]byte("The quick brown fox jumps over the lazy dog"))
+	data, err := sum.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeSum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Params() != params || decoded.String() != sum.String() {
+		t.Errorf("Decoded %v with %v, expected %v with %v", decoded, decoded.Params(), sum, params)
+	}
+	if decoded, err := hasher.DecodeSum(data); err != nil || decoded.String() != sum.String() {
+		t.Errorf("Hasher decoded %v, %v", decoded, err)
+	}
+
+	if _, err := defaultHasher.DecodeSum(data); err != ErrParamsMismatch {
+		t.Errorf("Decoding with other parameters returned %v", err)
+	}
+	other := SpamSum{params: DefaultParams}
+	if err := other.UnmarshalBinary(data); err != ErrParamsMismatch {
+		t.Errorf("Decoding into a sum with other parameters returned %v", err)
+	}
+}
+
+func TestUnmarshalBinaryKeepsCopies(t *testing.T) {
+	a := HashBytes([]byte("The quick brown fox jumps over the lazy dog"))
+	b := HashBytes([]byte("Pack my box with five dozen liquor jugs"))
+	dataA, _ := a.MarshalBinary()
+	dataB, _ := b.MarshalBinary()
+
+	var sum SpamSum
+	if err := sum.UnmarshalBinary(dataA); err != nil {
+		t.Fatal(err)
+	}
+	kept := sum
+	if err := sum.UnmarshalBinary(dataB); err != nil {
+		t.Fatal(err)
+	}
+	if kept.String() != a.String() {
+		t.Errorf("Decoding %v into a sum changed its copy to %v", b, &kept)
+	}
+}
+
+func TestRoundTripScores(t *testing.T) {
+	random := rand.New(rand.NewSource(38))
+	decode := func(sum *SpamSum) *SpamSum {
+		data, _ := sum.MarshalBinary()
+		decoded, err := DecodeSum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+	parse := func(sum *SpamSum) *SpamSum {
+		parsed := new(SpamSum)
+		if _, err := fmt.Sscan(sum.String(), parsed); err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	for i := 0; i < 200; i++ {
+		input := make([]byte, 1000+random.Intn(20000))
+		random.Read(input)
+		a := HashBytes(input)
+		for j := 0; j < 1+random.Intn(5); j++ {
+			start := random.Intn(len(input) - 100)
+			random.Read(input[start : start+random.Intn(100)])
+		}
+		b := HashBytes(input)
+
+		score := a.Compare(*b)
+		if decoded := decode(a).Compare(*decode(b)); decoded != score {
+			t.Errorf("%v and %v score %d, decoded %d", a, b, score, decoded)
+		}
+		if parsed := parse(a).Compare(*parse(b)); parsed != score {
+			t.Errorf("%v and %v score %d, parsed %d", a, b, score, parsed)
+		}
+	}
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	valid, _ := HashBytes([]byte("The quick brown fox jumps over the lazy dog")).MarshalBinary()
+
+	tooShort := valid[:len(valid)-1]
+	badVersion := append([]byte{2}, valid[1:]...)
+	badParams := append([]byte(nil), valid...)
+	badParams[3], badParams[4] = 0, 0
+	smallBlock := append(append(append([]byte(nil), valid[:9]...), 0, 0, 0, 1), valid[13:]...)
+	longLeft := append([]byte(nil), valid...)
+	longLeft[13], longLeft[14] = 0, SpamsumLength+1
+	badChar := append([]byte(nil), valid...)
+	badChar[15] = ':'
+
+	for _, data := range [][]byte{nil, valid[:8], tooShort, badVersion, badParams, smallBlock, longLeft, badChar} {
+		if _, err := DecodeSum(data); err == nil {
+			t.Errorf("Decoding %v should fail", data)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A MultiSum is a SpamSum extended with digests for additional, smaller
+// block sizes.  Where Compare can only match SpamSums whose block
+// sizes differ by at most a factor of two, MultiSums can match across
+// wider gaps.
+//
+// The string form of a MultiSum is that of its standard SpamSum,
+// followed by one colon-separated base64 string per extra block size:
+//
+//	blocksize:digest:digest2x:digest1/2x:digest1/4x...
+//
+// Every extra digest is computed the same way as the first half of a
+// SpamSum, at half the block size of the previous one.  A standard
+// SpamSum string is a valid MultiSum without extra digests.
+type MultiSum struct {
+	standard SpamSum
+	extra    [][]byte
+}
+
+// Standard returns the two-part SpamSum contained in the MultiSum.
+// It is identical to the SpamSum HashBytes or HashReadSeeker would
+// produce for the same input.
+func (ms *MultiSum) Standard() *SpamSum {
+	standard := ms.standard.clone()
+	return &standard
+}
+
+// BlockSizes returns the block sizes of all digests in the MultiSum,
+// largest first.
+func (ms *MultiSum) BlockSizes() []uint32 {
+	sizes := []uint32{ms.standard.blocksize * 2, ms.standard.blocksize}
+	for i := range ms.extra {
+		sizes = append(sizes, ms.standard.blocksize>>uint(i+1))
+	}
+	return sizes
+}
+
+// String produces the representation described in the documentation
+// of MultiSum.
+func (ms *MultiSum) String() string {
+	parts := []string{ms.standard.String()}
+	for _, digest := range ms.extra {
+		parts = append(parts, string(digest))
+	}
+	return strings.Join(parts, ":")
+}
+
+// Scan reads a MultiSum, or a standard SpamSum, in the form produced
+// by String.
+func (ms *MultiSum) Scan(state fmt.ScanState, verb rune) error {
+	if err := ms.standard.Scan(state, verb); err != nil {
+		return err
+	}
+
+	params := ms.standard.parameters()
+	ms.extra = nil
+	blocksize := ms.standard.blocksize
+
+	for {
+		if r, _, err := state.ReadRune(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if r != ':' {
+			return state.UnreadRune()
+		}
+
+		buffer, err := state.Token(false, // do not skip spaces
+			func(r rune) bool {
+				return (bytes.IndexRune([]byte(b64), r) != -1)
+			})
+		if err != nil {
+			return err
+		} else if len(buffer) > params.SignatureLength {
+			return errors.New("Extra base64 string too long")
+		}
+
+		if blocksize /= 2; blocksize < params.MinBlockSize {
+			return errors.New("Extra block size too small")
+		}
+		ms.extra = append(ms.extra, append([]byte(nil), buffer...))
+	}
+}
+
+// multiDigest is one digest of a MultiSum, along with the block size
+// it was hashed with and the block size used to cap its score.
+type multiDigest struct {
+	digest                  []byte
+	blocksize, capBlocksize uint32
+}
+
+func (ms *MultiSum) digests() []multiDigest {
+	standard := &ms.standard
+	digests := []multiDigest{
+		// as in Compare, the second halves are capped using
+		// the block size of the first halves
+		{standard.rightPart[:standard.rightIndex], standard.blocksize * 2, standard.blocksize},
+		{standard.leftPart[:standard.leftIndex], standard.blocksize, standard.blocksize},
+	}
+	for i, digest := range ms.extra {
+		blocksize := standard.blocksize >> uint(i+1)
+		digests = append(digests, multiDigest{digest, blocksize, blocksize})
+	}
+	return digests
+}
+
+// Compare two MultiSums, returning a value between 0 and 100.  The
+// score is the best one of all pairs of digests with the same block
+// size.  MultiSums without extra digests compare exactly like their
+// standard SpamSums.
+func (from MultiSum) Compare(to MultiSum) (similarity uint32) {
+	params := from.standard.parameters()
+	if params != to.standard.parameters() {
+		return 0
+	}
+
+	for _, f := range from.digests() {
+		for _, t := range to.digests() {
+			if f.blocksize != t.blocksize {
+				continue
+			}
+			capBlocksize := max(int(f.capBlocksize), int(t.capBlocksize))
+			similarity = uint32(max(int(similarity),
+				score(f.digest, t.digest, capBlocksize, params)))
+		}
+	}
+	return
+}
+
+// HashMultiBytes takes the MultiSum of a byte slice, with up to extra
+// additional digests.  Fewer are produced if the block size would drop
+// below the minimum.
+func HashMultiBytes(b []byte, extra int) *MultiSum {
+	return defaultHasher.HashMultiBytes(b, extra)
+}
+
+// HashMultiReadSeeker takes the MultiSum of the first length bytes of
+// source, with up to extra additional digests.  All block sizes are
+// hashed simultaneously, so source is normally read only once; it is
+// read again only if the input is so repetitive that the standard
+// block size ends up well below its first estimate.  Any errors
+// returned will originate from source.
+func HashMultiReadSeeker(source io.ReadSeeker, length int64, extra int) (*MultiSum, error) {
+	return defaultHasher.HashMultiReadSeeker(source, length, extra)
+}
+
+// HashMultiBytes is like the package-level HashMultiBytes, using the
+// parameters of the Hasher.
+func (h *Hasher) HashMultiBytes(b []byte, extra int) *MultiSum {
+	// errors won't be produced for an in-memory byte slice
+	result, _ := h.HashMultiReadSeeker(bytes.NewReader(b), int64(len(b)), extra)
+	return result
+}
+
+// multiSlack is the number of times the block size may be halved
+// after the first estimate before another pass is needed.
+const multiSlack = 2
+
+// HashMultiReadSeeker is like the package-level HashMultiReadSeeker,
+// using the parameters of the Hasher.
+func (h *Hasher) HashMultiReadSeeker(source io.ReadSeeker, length int64, extra int) (*MultiSum, error) {
+	if extra < 0 {
+		return nil, errors.New("Number of extra digests must not be negative")
+	}
+
+	top := h.params.MinBlockSize
+	for int64(top)*int64(h.params.SignatureLength) < length {
+		top *= 2
+	}
+
+	for {
+		// sums[i] has block size top >> i
+		sums := make([]*SpamSum, 0)
+		states := make([]spamsumState, 0)
+		for blocksize := top; len(sums) <= extra+multiSlack; blocksize /= 2 {
+			sum := h.newSum()
+			sum.blocksize = blocksize
+			sums = append(sums, sum)
+			states = append(states, spamsumState{})
+			states[len(states)-1].init(h.params)
+			if blocksize/2 < h.params.MinBlockSize {
+				break
+			}
+		}
+
+		if _, err := source.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		block := make([]byte, ReadSize)
+		for {
+			num, err := source.Read(block)
+			if num == 0 {
+				break
+			}
+			for i := range sums {
+				processBlock(block, num, &states[i], sums[i])
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// the same halving rule as HashReadSeeker
+		chosen := 0
+		for chosen < len(sums)-1 &&
+			sums[chosen].leftIndex < h.params.SignatureLength/2 {
+			chosen++
+		}
+		for i := range sums {
+			writeTail(&states[i], sums[i])
+		}
+
+		standard := sums[chosen]
+		if chosen == len(sums)-1 && standard.blocksize > h.params.MinBlockSize &&
+			standard.leftIndex < h.params.SignatureLength/2 {
+			// the block size has to drop further than
+			// expected, which needs another pass.
+			top = standard.blocksize / 2
+			continue
+		}
+
+		standard.countTail()
+		multi := &MultiSum{standard: *standard}
+		for i := chosen + 1; i < len(sums) && i <= chosen+extra; i++ {
+			digest := sums[i].leftPart[:nonZeroLength(sums[i].leftPart)]
+			multi.extra = append(multi.extra, digest)
+		}
+
+		if chosen+extra > len(sums)-1 &&
+			sums[len(sums)-1].blocksize/2 >= h.params.MinBlockSize {
+			// not enough levels hashed below the chosen
+			// block size; hash again starting from it.
+			top = standard.blocksize
+			continue
+		}
+
+		if h.options.EliminateSequences {
+			multi.standard.eliminateSequences()
+			for i, digest := range multi.extra {
+				multi.extra[i] = eliminateRepetition(digest)
+			}
+		}
+		return multi, nil
+	}
+}
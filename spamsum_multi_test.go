@@ -0,0 +1,141 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func multiTestInputs(t *testing.T) map[string][]byte {
+	inputs := make(map[string][]byte)
+	for _, filename := range []string{"LAND.MAP", "embedded_video_quicktime.doc"} {
+		contents, err := os.ReadFile(filepath.Join("testdata", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[filename] = contents
+	}
+
+	random := make([]byte, 22624)
+	rand.New(rand.NewSource(1252877)).Read(random)
+	inputs["random"] = random
+
+	// mostly zeroes, so the block size drops to the minimum
+	padded := make([]byte, 17921)
+	generator := rand.New(rand.NewSource(191))
+	for i := 0; i < 24; i++ {
+		binary.BigEndian.PutUint32(padded[i*4:], generator.Uint32())
+	}
+	inputs["padded"] = padded
+
+	inputs["empty"] = []byte{}
+	return inputs
+}
+
+func TestMultiSumStandard(t *testing.T) {
+	for name, input := range multiTestInputs(t) {
+		for _, extra := range []int{0, 1, 3, 8} {
+			multi := HashMultiBytes(input, extra)
+			if multi.Standard().String() != HashBytes(input).String() {
+				t.Errorf("%s, %d extra: standard sum is %v, should be %v",
+					name, extra, multi.Standard(), HashBytes(input))
+			}
+
+			sizes := multi.BlockSizes()
+			if expected := min(extra+2, len(sizes)); len(sizes) != expected ||
+				(len(sizes) < extra+2 && sizes[len(sizes)-1] != minBlockSize) {
+				t.Errorf("%s, %d extra: unexpected block sizes %v", name, extra, sizes)
+			}
+
+			parts := strings.Split(multi.String(), ":")
+			for i, blocksize := range sizes[2:] {
+				writer := StartFixedBlocksize(blocksize)
+				writer.Write(input)
+				expected := strings.Split(writer.String(), ":")[1]
+				if parts[i+3] != expected {
+					t.Errorf("%s: digest for block size %d is %s, should be %s",
+						name, blocksize, parts[i+3], expected)
+				}
+			}
+		}
+	}
+}
+
+func TestMultiSumScan(t *testing.T) {
+	inputs := multiTestInputs(t)
+	for _, input := range []string{
+		HashMultiBytes(inputs["LAND.MAP"], 4).String(),
+		HashMultiBytes(inputs["random"], 2).String(),
+		"49152:dihMNzhZt62oh9+onrqMPr/KwJsvD/mMplt:Hxxpj",
+	} {
+		var multi MultiSum
+		if _, err := fmt.Sscan(input, &multi); err != nil {
+			t.Errorf("Could not scan %s: %v", input, err)
+		} else if multi.String() != input {
+			t.Errorf("Scanned %s as %v", input, &multi)
+		}
+	}
+
+	var multi MultiSum
+	if _, err := fmt.Sscan("6:abc:de:fg:hi", &multi); err == nil {
+		t.Errorf("Extra digests below the minimum block size should not scan")
+	}
+}
+
+func TestMultiSumCompareStandard(t *testing.T) {
+	sums := []string{
+		"12582912:kVxeXup8VuH8rD//4crHBrlGXm5WgYJ70A:e4XuptH8D//4crHMmUfL",
+		"12582912:kVxeXup8VuH8rD//4crHBrlGXm5WGYJ70A:e4XuptH8D//4crHMMUfL",
+		"96:aaUi0DTEnLMZMVd2jnEMyFrsdy9LdeGatg3Uogbqs0uBUZoXLn1IvwwDaK:aaf0PU8YMnElrcULdSWgbqs0uBb1IIK",
+		"192:aaf6PU8YMnElrcULdSWgbqs0uBb1IIAfsR6OZWjZDx:aaf6PUcYrfLdSWgms0uBb1TA0lZ8ZDx",
+		"48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs",
+		"48:w+wNj5GLBX/8jrT14EHWFIUXs0hPbaL3qd9hI6h0:w+zLBX/w14EecWT6ad9hs",
+	}
+
+	for _, left := range sums {
+		for _, right := range sums {
+			var from, to SpamSum
+			var multiFrom, multiTo MultiSum
+			fmt.Sscan(left, &from)
+			fmt.Sscan(right, &to)
+			fmt.Sscan(left, &multiFrom)
+			fmt.Sscan(right, &multiTo)
+
+			if multiFrom.Compare(multiTo) != from.Compare(to) {
+				t.Errorf("MultiSums %s and %s score %d, SpamSums score %d",
+					left, right, multiFrom.Compare(multiTo), from.Compare(to))
+			}
+		}
+	}
+}
+
+func TestMultiSumWideGap(t *testing.T) {
+	known, err := os.ReadFile(filepath.Join("testdata", "embedded_video_quicktime.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := make([]byte, 600000)
+	rand.New(rand.NewSource(2048)).Read(archive)
+	copy(archive, known)
+
+	if score := HashBytes(known).Compare(*HashBytes(archive)); score != 0 {
+		t.Fatalf("Standard sums should not be comparable, scored %d", score)
+	}
+
+	small, large := HashMultiBytes(known, 2), HashMultiBytes(archive, 8)
+	if score := small.Compare(*large); score < 50 {
+		t.Errorf("%v and %v should match, scored %d", small, large, score)
+	}
+	if score := large.Compare(*small); score != small.Compare(*large) {
+		t.Errorf("Comparison of MultiSums is not symmetrical")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"io"
+)
+
+// DigestOptions select variations on the standard digest, matching
+// the flags of ssdeep's fuzzy_digest.
+type DigestOptions struct {
+	// EliminateSequences shortens runs of more than three
+	// identical characters in either half of the digest to three
+	// characters, like FUZZY_FLAG_ELIMSEQ.
+	EliminateSequences bool
+	// NoTruncate lets the second half of the digest grow as long
+	// as the first, like FUZZY_FLAG_NOTRUNC, rather than folding
+	// everything after half the signature length into its last
+	// character.
+	NoTruncate bool
+}
+
+// WithOptions returns a Hasher with the parameters of h, producing
+// digests according to options.
+func (h *Hasher) WithOptions(options DigestOptions) *Hasher {
+	return &Hasher{params: h.params, options: options}
+}
+
+// Options returns the DigestOptions of the Hasher.
+func (h *Hasher) Options() DigestOptions {
+	return h.options
+}
+
+// HashBytesOptions is like HashBytes, producing a digest according
+// to options.
+func HashBytesOptions(b []byte, options DigestOptions) *SpamSum {
+	return defaultHasher.WithOptions(options).HashBytes(b)
+}
+
+// HashReadSeekerOptions is like HashReadSeeker, producing a digest
+// according to options.
+func HashReadSeekerOptions(source io.ReadSeeker, length int64, options DigestOptions) (*SpamSum, error) {
+	return defaultHasher.WithOptions(options).HashReadSeeker(source, length)
+}
+
+// StartFixedBlocksizeOptions is like StartFixedBlocksize, producing a
+// digest according to options.
+func StartFixedBlocksizeOptions(blockSize uint32, options DigestOptions) *SpamSumWriter {
+	return defaultHasher.WithOptions(options).StartFixedBlocksize(blockSize)
+}
+
+// eliminateSequences applies EliminateSequences to both halves of
+// the sum.
+func (sum *SpamSum) eliminateSequences() {
+	sum.leftIndex = eliminateSequencesIn(sum.leftPart, sum.leftIndex)
+	sum.rightIndex = eliminateSequencesIn(sum.rightPart, sum.rightIndex)
+}
+
+// eliminateSequencesIn removes repeated characters from the
+// zero-terminated part in place, and returns the position index
+// moves to.
+func eliminateSequencesIn(part []byte, index int) int {
+	reduced := eliminateRepetition(part[:nonZeroLength(part)])
+	index = len(eliminateRepetition(part[:index]))
+
+	copy(part, reduced)
+	for i := len(reduced); i < len(part); i++ {
+		part[i] = 0
+	}
+	return index
+}
+
+// alignTruncation makes a truncated and an untruncated second half
+// comparable.  The last character of a full truncated half hashes
+// all remaining blocks, and has no counterpart in an untruncated
+// one, so it is left out, along with everything past it in the
+// untruncated half.
+func alignTruncation(from, to []byte, params Params) ([]byte, []byte) {
+	half := params.SignatureLength / 2
+	if len(from) > half && len(to) == half ||
+		len(to) > half && len(from) == half {
+		return from[:half-1], to[:half-1]
+	}
+	return from, to
+}
@@ -0,0 +1,87 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEliminateSequences(t *testing.T) {
+	input := bytes.Repeat([]byte("The quick "), 2000)
+
+	if sum := HashBytes(input).String(); sum != "6:FLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLLt:FN" {
+		t.Fatalf("Unexpected standard digest %s", sum)
+	}
+
+	options := DigestOptions{EliminateSequences: true}
+	if sum := HashBytesOptions(input, options).String(); sum != "6:FLLLt:FN" {
+		t.Errorf("Sequences not eliminated from %s", sum)
+	}
+
+	writer := StartFixedBlocksizeOptions(6, options)
+	writer.Write(input)
+	if sum := writer.String(); sum != "6:FLLLt:FN" {
+		t.Errorf("Sequences not eliminated from writer output %s", sum)
+	}
+}
+
+func TestNoTruncate(t *testing.T) {
+	// long enough to overflow the second half
+	contents := make([]byte, 64*3072)
+	rand.New(rand.NewSource(4)).Read(contents)
+
+	standard := HashBytes(contents)
+	long := HashBytesOptions(contents, DigestOptions{NoTruncate: true})
+	if long.BlockSize() != standard.BlockSize() {
+		t.Fatalf("NoTruncate changed the block size of %v to %v", standard, long)
+	}
+
+	standardParts := strings.Split(standard.String(), ":")
+	longParts := strings.Split(long.String(), ":")
+	if standardParts[1] != longParts[1] {
+		t.Errorf("NoTruncate changed the first half of %v to %v", standard, long)
+	}
+	if len(longParts[2]) <= SpamsumLength/2 || len(longParts[2]) > SpamsumLength ||
+		!strings.HasPrefix(longParts[2], standardParts[2][:SpamsumLength/2-1]) {
+		t.Errorf("%v is not an untruncated form of %v", long, standard)
+	}
+
+	var parsed SpamSum
+	if _, err := fmt.Sscan(long.String(), &parsed); err != nil {
+		t.Fatal(err)
+	} else if parsed.String() != long.String() {
+		t.Errorf("Parsing %v produced %v", long, &parsed)
+	}
+	if score := parsed.Compare(parsed); score != 100 {
+		t.Errorf("Untruncated digest should match itself, got %d", score)
+	}
+
+	var truncated SpamSum
+	fmt.Sscan(standard.String(), &truncated)
+	if a, b := parsed.Compare(truncated), truncated.Compare(parsed); a != b || a < 90 {
+		t.Errorf("Truncated and untruncated digests of the same input score %d and %d", a, b)
+	}
+}
+
+func TestNoTruncateWriter(t *testing.T) {
+	input := make([]byte, 20000)
+	rand.New(rand.NewSource(37)).Read(input)
+
+	standard := StartFixedBlocksize(96)
+	long := StartFixedBlocksizeOptions(96, DigestOptions{NoTruncate: true})
+	standard.Write(input)
+	long.Write(input)
+
+	standardRight := strings.Split(standard.String(), ":")[2]
+	longRight := strings.Split(long.String(), ":")[2]
+	if len(standardRight) != SpamsumLength/2 || len(longRight) <= SpamsumLength/2 ||
+		!strings.HasPrefix(longRight, standardRight[:SpamsumLength/2-1]) {
+		t.Errorf("%s is not an untruncated form of %s", longRight, standardRight)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Params are the tunable parameters of the spamsum algorithm.
+type Params struct {
+	// SignatureLength is the maximum number of characters in the
+	// first half of a signature.  The second half holds up to
+	// half as many.
+	SignatureLength int
+	// Window is the number of bytes the rolling hash looks at,
+	// and the length of the common substring two signatures need
+	// before Compare gives them a non-zero score.
+	Window int
+	// MinBlockSize is the smallest block size used.  All block
+	// sizes chosen by a Hasher are MinBlockSize times a power of
+	// two.
+	MinBlockSize uint32
+}
+
+// DefaultParams are the parameters used by the original spamsum tool
+// and ssdeep, and by the package-level functions.
+var DefaultParams = Params{
+	SignatureLength: SpamsumLength,
+	Window:          rollingWindow,
+	MinBlockSize:    minBlockSize,
+}
+
+// ErrParamsMismatch is returned when comparing SpamSums that were
+// made with different Params.
+var ErrParamsMismatch = errors.New("SpamSums were made with different parameters")
+
+// orDefault returns DefaultParams for the zero value, so that a
+// zero SpamSum behaves like one made with the default parameters.
+func (p Params) orDefault() Params {
+	if p == (Params{}) {
+		return DefaultParams
+	}
+	return p
+}
+
+func (p Params) validate() error {
+	if p.SignatureLength < 2 {
+		return errors.New("Signature length must be at least 2")
+	}
+	if p.Window < 1 || p.Window > p.SignatureLength/2 {
+		return errors.New("Window must be between 1 and half the signature length")
+	}
+	if p.MinBlockSize < 1 {
+		return errors.New("Minimum block size must be positive")
+	}
+	return nil
+}
+
+// A Hasher takes and compares SpamSums using a particular set of
+// Params, producing digests according to its DigestOptions.
+type Hasher struct {
+	params  Params
+	options DigestOptions
+}
+
+var defaultHasher = &Hasher{params: DefaultParams}
+
+// NewHasher returns a Hasher using params, or an error if the params
+// are unusable.
+func NewHasher(params Params) (*Hasher, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return &Hasher{params: params}, nil
+}
+
+// Params returns the parameters of the Hasher.
+func (h *Hasher) Params() Params {
+	return h.params
+}
+
+// newSum returns an empty SpamSum for the parameters of the Hasher.
+func (h *Hasher) newSum() *SpamSum {
+	sum := &SpamSum{params: h.params, options: h.options}
+	sum.reset()
+	return sum
+}
+
+// HashBytes is like the package-level HashBytes, using the parameters
+// of the Hasher.
+func (h *Hasher) HashBytes(b []byte) *SpamSum {
+	// errors won't be produced for an in-memory byte slice
+	result, _ := h.hashReadSeeker(bytes.NewReader(b), int64(len(b)), nil, nil)
+	return result
+}
+
+// HashReadSeeker is like the package-level HashReadSeeker, using the
+// parameters of the Hasher.
+func (h *Hasher) HashReadSeeker(source io.ReadSeeker, length int64) (*SpamSum, error) {
+	return h.hashReadSeeker(source, length, nil, nil)
+}
+
+// StartFixedBlocksize is like the package-level StartFixedBlocksize,
+// using the parameters of the Hasher.
+func (h *Hasher) StartFixedBlocksize(blockSize uint32) *SpamSumWriter {
+	sum := new(SpamSumWriter)
+
+	sum.SpamSum = *h.newSum()
+	sum.spamsumState.init(h.params)
+
+	sum.blocksize = blockSize
+	return sum
+}
+
+// Parse reads a SpamSum in the form produced by String, checking it
+// against the parameters of the Hasher.
+func (h *Hasher) Parse(s string) (*SpamSum, error) {
+	sum := &SpamSum{params: h.params}
+	if _, err := fmt.Sscan(s, sum); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// Compare is like SpamSum.Compare, but returns ErrParamsMismatch
+// rather than a score of 0 if either SpamSum was not made with the
+// parameters of the Hasher.
+func (h *Hasher) Compare(from, to *SpamSum) (uint32, error) {
+	if from.parameters() != h.params || to.parameters() != h.params {
+		return 0, ErrParamsMismatch
+	}
+	return from.Compare(*to), nil
+}
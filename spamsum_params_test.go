@@ -0,0 +1,125 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultHasher(t *testing.T) {
+	hasher, err := NewHasher(DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{"LAND.MAP", "embedded_video_quicktime.doc"} {
+		contents, err := os.ReadFile(filepath.Join("testdata", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum, expected := hasher.HashBytes(contents), HashBytes(contents)
+		if sum.String() != expected.String() {
+			t.Errorf("Default parameters produce %v for %s, should be %v", sum, filename, expected)
+		}
+		if score, err := hasher.Compare(sum, expected); err != nil || score != 100 {
+			t.Errorf("Sums with default parameters should compare, got %d, %v", score, err)
+		}
+	}
+}
+
+func TestLongSignatures(t *testing.T) {
+	hasher, err := NewHasher(Params{SignatureLength: 128, Window: 7, MinBlockSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join("testdata", "LAND.MAP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := hasher.HashBytes(contents)
+	parts := strings.Split(long.String(), ":")
+	if len(parts[1]) <= SpamsumLength || len(parts[1]) > 128 || len(parts[2]) > 64 {
+		t.Errorf("Unexpected signature lengths in %v", long)
+	}
+	standard := HashBytes(contents)
+	if long.BlockSize() == standard.BlockSize() &&
+		!strings.HasPrefix(long.String(), standard.String()[:len(standard.String())-4]) {
+		t.Errorf("%v should extend %v", long, standard)
+	}
+
+	parsed, err := hasher.Parse(long.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != long.String() {
+		t.Errorf("Parsing %v produced %v", long, parsed)
+	}
+	if score, err := hasher.Compare(long, parsed); err != nil || score != 100 {
+		t.Errorf("A parsed signature should match the original, got %d, %v", score, err)
+	}
+
+	if _, err := defaultHasher.Parse(long.String()); err == nil {
+		t.Errorf("A %d character signature should not parse with default parameters", len(parts[1]))
+	}
+
+	if _, err := hasher.Compare(long, standard); err != ErrParamsMismatch {
+		t.Errorf("Comparing sums with different parameters should fail, got %v", err)
+	}
+	if score := long.Compare(*standard); score != 0 {
+		t.Errorf("Sums with different parameters should score 0, got %d", score)
+	}
+}
+
+func TestWindowParam(t *testing.T) {
+	hasher, err := NewHasher(Params{SignatureLength: 64, Window: 5, MinBlockSize: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join("testdata", "embedded_video_quicktime.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := hasher.HashBytes(contents)
+	if sum.BlockSize()%6 != 0 {
+		t.Errorf("Block size %d is not a multiple of the minimum block size", sum.BlockSize())
+	}
+	if sum.String() == HashBytes(contents).String() {
+		t.Errorf("A different window should produce a different sum")
+	}
+
+	edited := append([]byte(nil), contents...)
+	copy(edited[10000:], "a short edit in the middle")
+	if score, _ := hasher.Compare(sum, hasher.HashBytes(edited)); score < 50 {
+		t.Errorf("A small edit should keep a high score, got %d", score)
+	}
+
+	writer := hasher.StartFixedBlocksize(uint32(sum.BlockSize()))
+	writer.Write(contents)
+	if writer.String() != sum.String() {
+		t.Errorf("Writer produced %v, should be %v", writer, sum)
+	}
+}
+
+func TestNewHasherValidates(t *testing.T) {
+	for _, params := range []Params{
+		{},
+		{SignatureLength: 1, Window: 1, MinBlockSize: 3},
+		{SignatureLength: 64, Window: 0, MinBlockSize: 3},
+		{SignatureLength: 64, Window: 33, MinBlockSize: 3},
+		{SignatureLength: 64, Window: 7, MinBlockSize: 0},
+	} {
+		if _, err := NewHasher(params); err == nil {
+			t.Errorf("Params %v should be refused", params)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"errors"
+	"io"
+)
+
+// A Piece is the SpamSum of one segment of a larger input.  Offset
+// and Length locate the segment in that input.
+type Piece struct {
+	Offset, Length int64
+	Sum            *SpamSum
+}
+
+// A PieceMatch is a Piece that resembles a known SpamSum, together
+// with the similarity score that Compare assigned it.
+type PieceMatch struct {
+	Piece
+	Score uint32
+}
+
+// HashPieces reads source until EOF, cuts it into consecutive
+// segments of segmentSize bytes (the last one may be shorter), and
+// takes the SpamSum of every segment with its own optimal block size.
+// The pieces are returned in input order.  Any errors returned will
+// originate from source.
+func HashPieces(source io.Reader, segmentSize int) ([]Piece, error) {
+	if segmentSize <= 0 {
+		return nil, errors.New("Segment size must be positive")
+	}
+
+	pieces := make([]Piece, 0)
+	segment := make([]byte, segmentSize)
+	var offset int64
+
+	for {
+		num, err := io.ReadFull(source, segment)
+		if num > 0 {
+			pieces = append(pieces, Piece{offset, int64(num), HashBytes(segment[:num])})
+			offset += int64(num)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pieces, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// HashPiecesContentDefined is like HashPieces, but places segment
+// boundaries where the rolling hash triggers, so that an insertion or
+// deletion early in the input does not shift every later boundary.
+// Segments are averageSize bytes long on average, and never shorter
+// than averageSize/4 or longer than averageSize*4, except for the
+// last one.
+func HashPiecesContentDefined(source io.Reader, averageSize int) ([]Piece, error) {
+	if averageSize < minBlockSize {
+		return nil, errors.New("Average segment size too small")
+	}
+
+	chunker, err := NewChunker(source, averageSize/4, averageSize, averageSize*4)
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := make([]Piece, 0)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return pieces, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		pieces = append(pieces, Piece{chunk.Offset, int64(len(chunk.Data)), HashBytes(chunk.Data)})
+	}
+}
+
+// MatchPieces compares every piece against known, and returns the
+// pieces scoring at least threshold, in input order.  This can be
+// used to locate a small known file inside a large input that was
+// hashed piecewise.
+func MatchPieces(pieces []Piece, known SpamSum, threshold uint32) []PieceMatch {
+	matches := make([]PieceMatch, 0)
+	for _, piece := range pieces {
+		if score := piece.Sum.Compare(known); score > 0 && score >= threshold {
+			matches = append(matches, PieceMatch{piece, score})
+		}
+	}
+	return matches
+}
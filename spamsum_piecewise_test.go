@@ -0,0 +1,93 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// embedKnownFile surrounds the contents of a test file with random
+// data, returning the combined input and the test file contents.
+func embedKnownFile(t *testing.T, filename string, before, after int) (image, known []byte) {
+	known, err := os.ReadFile(filepath.Join("testdata", filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generator := rand.New(rand.NewSource(5521))
+	image = make([]byte, before+len(known)+after)
+	generator.Read(image)
+	copy(image[before:], known)
+	return image, known
+}
+
+func TestHashPieces(t *testing.T) {
+	before, after := 40000, 70000
+	image, known := embedKnownFile(t, "embedded_video_quicktime.doc", before, after)
+	knownSum := HashBytes(known)
+
+	tests := []struct {
+		size           int
+		contentDefined bool
+	}{
+		{8192, false},
+		{16384, false},
+		{2048, true},
+		{4096, true},
+	}
+
+	for _, test := range tests {
+		var pieces []Piece
+		var err error
+		if test.contentDefined {
+			pieces, err = HashPiecesContentDefined(bytes.NewReader(image), test.size)
+		} else {
+			pieces, err = HashPieces(bytes.NewReader(image), test.size)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var offset int64
+		for _, piece := range pieces {
+			if piece.Offset != offset {
+				t.Errorf("Piece at offset %d should start at %d", piece.Offset, offset)
+			}
+			if !test.contentDefined && piece.Length > int64(test.size) {
+				t.Errorf("Piece of length %d exceeds segment size %d", piece.Length, test.size)
+			}
+			offset += piece.Length
+		}
+		if offset != int64(len(image)) {
+			t.Errorf("Pieces cover %d bytes, input was %d bytes", offset, len(image))
+		}
+
+		matches := MatchPieces(pieces, *knownSum, 40)
+		if len(matches) == 0 {
+			t.Errorf("No piece of size %d matches the embedded file", test.size)
+		}
+		for _, match := range matches {
+			if match.Offset+match.Length <= int64(before) ||
+				match.Offset >= int64(before+len(known)) {
+				t.Errorf("Piece %d-%d matches with score %d, but does not overlap the embedded file",
+					match.Offset, match.Offset+match.Length, match.Score)
+			}
+		}
+	}
+}
+
+func TestHashPiecesEmpty(t *testing.T) {
+	pieces, err := HashPieces(bytes.NewReader(nil), 4096)
+	if err != nil || len(pieces) != 0 {
+		t.Errorf("Empty input should produce no pieces, got %v, %v", pieces, err)
+	}
+	if _, err := HashPieces(bytes.NewReader(nil), 0); err == nil {
+		t.Errorf("Segment size 0 should be refused")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"math"
+)
+
+// Quality describes how much information the two halves of a SpamSum
+// carry.  Short inputs, and inputs with long runs of identical bytes,
+// produce digests that are too short or too repetitive to match
+// anything meaningfully.
+type Quality struct {
+	// the number of characters in each half of the digest
+	LeftLength, RightLength int
+	// the number of characters left after runs of more than
+	// three identical characters are shortened
+	LeftReduced, RightReduced int
+	// the Shannon entropy of the characters, in bits per
+	// character; at most 6
+	LeftEntropy, RightEntropy float64
+	// whether either half is long enough to ever pass the
+	// common substring test in Compare
+	Comparable bool
+}
+
+const (
+	// minIndexLength is the number of characters, in multiples
+	// of the window, that a digest half needs after repetition
+	// is eliminated to be worth indexing.
+	minIndexLength = 2
+	// minIndexEntropy is the entropy, in bits per character, that
+	// a digest half needs to be worth indexing.
+	minIndexEntropy = 3.0
+)
+
+// Quality reports on the information content of the SpamSum, as it
+// appears in the digest String returns.
+func (ss *SpamSum) Quality() Quality {
+	left := ss.leftPart[:nonZeroLength(ss.leftPart)]
+	right := ss.rightPart[:nonZeroLength(ss.rightPart)]
+	window := ss.parameters().Window
+
+	return Quality{
+		LeftLength:   len(left),
+		RightLength:  len(right),
+		LeftReduced:  len(eliminateRepetition(left)),
+		RightReduced: len(eliminateRepetition(right)),
+		LeftEntropy:  entropy(left),
+		RightEntropy: entropy(right),
+		Comparable:   len(left) >= window || len(right) >= window,
+	}
+}
+
+// WorthIndexing returns true if at least one half of the SpamSum is
+// long and varied enough that a match on it is meaningful.  Digests
+// failing this test mostly produce coincidental matches, or none at
+// all, and are better left out of a similarity index.
+func (ss *SpamSum) WorthIndexing() bool {
+	q := ss.Quality()
+	minLength := minIndexLength * ss.parameters().Window
+
+	return q.Comparable &&
+		((q.LeftReduced >= minLength && q.LeftEntropy >= minIndexEntropy) ||
+			(q.RightReduced >= minLength && q.RightEntropy >= minIndexEntropy))
+}
+
+// entropy returns the Shannon entropy of the bytes in digest, in bits
+// per byte.
+func entropy(digest []byte) (bits float64) {
+	var counts [256]int
+	for _, c := range digest {
+		counts[c]++
+	}
+
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(digest))
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
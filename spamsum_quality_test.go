@@ -0,0 +1,97 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuality(t *testing.T) {
+	tests := []struct {
+		input        string
+		expected     Quality
+		worthIndexed bool
+	}{
+		{"3:Bl5KOiWl/:ldZ/",
+			Quality{9, 4, 9, 4, 2.9477, 2, true}, false},
+		{"3:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA:AAAAAAAAAAAAAAAAA",
+			Quality{36, 17, 3, 3, 0, 0, true}, false},
+		{"3:ABC:DE",
+			Quality{3, 2, 3, 2, 1.585, 1, false}, false},
+		{"48:w+wNj5GLBX/8jrT14EHWFIUXs0hPbaL3qd9hI6h0:w+zLBX/w14EecWT6ad9hs",
+			Quality{40, 21, 40, 21, 4.9031, 4.2971, true}, true},
+	}
+
+	for _, test := range tests {
+		var sum SpamSum
+		if _, err := fmt.Sscan(test.input, &sum); err != nil {
+			t.Fatal(err)
+		}
+
+		q := sum.Quality()
+		if q.LeftLength != test.expected.LeftLength ||
+			q.RightLength != test.expected.RightLength ||
+			q.LeftReduced != test.expected.LeftReduced ||
+			q.RightReduced != test.expected.RightReduced ||
+			q.Comparable != test.expected.Comparable ||
+			math.Abs(q.LeftEntropy-test.expected.LeftEntropy) > 0.001 ||
+			math.Abs(q.RightEntropy-test.expected.RightEntropy) > 0.001 {
+			t.Errorf("Quality of %s is %+v, should be %+v", test.input, q, test.expected)
+		}
+
+		if sum.WorthIndexing() != test.worthIndexed {
+			t.Errorf("%s should be worth indexing: %v", test.input, test.worthIndexed)
+		}
+	}
+}
+
+func TestQualityOfHashedInput(t *testing.T) {
+	// the input of TestBlocksizeAdjustment
+	byteSlice := make([]byte, 17921)
+	generator := rand.New(rand.NewSource(191))
+	for i := 0; i < 24; i++ {
+		binary.BigEndian.PutUint32(byteSlice[i*4:], generator.Uint32())
+	}
+	for i := 24; i < len(byteSlice); i++ {
+		byteSlice[i] = 0
+	}
+
+	sum := HashBytes(byteSlice)
+	if sum.WorthIndexing() {
+		t.Errorf("%v should not be worth indexing", sum)
+	}
+
+	random := make([]byte, 22624)
+	rand.New(rand.NewSource(1252877)).Read(random)
+	if sum := HashBytes(random); !sum.WorthIndexing() {
+		t.Errorf("%v should be worth indexing", sum)
+	}
+}
+
+func TestQualityOfParsedDigest(t *testing.T) {
+	input := []byte("hello world")
+	writer := StartFixedBlocksize(3)
+	writer.Write(input)
+	if writer.String() != HashBytes(input).String() {
+		t.Fatalf("Writer hashed %s, expected %v", writer.String(), HashBytes(input))
+	}
+
+	for _, sum := range []*SpamSum{HashBytes(input), &writer.SpamSum} {
+		var parsed SpamSum
+		if _, err := fmt.Sscan(sum.String(), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		if sum.Quality() != parsed.Quality() || sum.WorthIndexing() != parsed.WorthIndexing() {
+			t.Errorf("%v has quality %v, parsed %v", sum, sum.Quality(), parsed.Quality())
+		}
+	}
+	if !HashBytes(input).Quality().Comparable {
+		t.Errorf("%v should be comparable", HashBytes(input))
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// HashAtBlockSize takes the SpamSum of everything read from source,
+// using blocksize rather than a block size chosen for the length of
+// the input.  Use it to hash data at the block size of a stored
+// SpamSum, so that the two can be compared.  Any errors returned will
+// originate from source, unless blocksize is smaller than the minimum
+// block size.
+func HashAtBlockSize(source io.Reader, blocksize uint32) (*SpamSum, error) {
+	return defaultHasher.HashAtBlockSize(source, blocksize)
+}
+
+// HashAtBlockSize is like the package-level HashAtBlockSize, using the
+// parameters and options of the Hasher.
+func (h *Hasher) HashAtBlockSize(source io.Reader, blocksize uint32) (*SpamSum, error) {
+	if blocksize < h.params.MinBlockSize {
+		return nil, errors.New("Block size too small")
+	}
+
+	sum := h.newSum()
+	sum.blocksize = blocksize
+	sss := spamsumState{}
+	sss.init(h.params)
+
+	block := make([]byte, ReadSize)
+	for {
+		num, err := source.Read(block)
+		processBlock(block, num, &sss, sum)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	writeTail(&sss, sum)
+	sum.countTail()
+	if h.options.EliminateSequences {
+		sum.eliminateSequences()
+	}
+	return sum, nil
+}
+
+// CompareBytes hashes a and b, and compares them.  If the block sizes
+// HashBytes would choose for them are too far apart for Compare, each
+// input is also hashed at the block size chosen for the other, and
+// the best scoring pair of SpamSums at a shared block size is used.
+// Returns the score, and the SpamSums it was computed from.
+func CompareBytes(a, b []byte) (uint32, *SpamSum, *SpamSum) {
+	return defaultHasher.CompareBytes(a, b)
+}
+
+// CompareBytes is like the package-level CompareBytes, using the
+// parameters and options of the Hasher.
+func (h *Hasher) CompareBytes(a, b []byte) (uint32, *SpamSum, *SpamSum) {
+	// errors won't be produced for in-memory byte slices
+	score, from, to, _ := h.CompareReadSeekers(
+		bytes.NewReader(a), int64(len(a)), bytes.NewReader(b), int64(len(b)))
+	return score, from, to
+}
+
+// CompareReadSeekers is like CompareBytes, for the first aLength bytes
+// of a and the first bLength bytes of b.  Any errors returned will
+// originate from a or b.
+func CompareReadSeekers(a io.ReadSeeker, aLength int64, b io.ReadSeeker, bLength int64) (uint32, *SpamSum, *SpamSum, error) {
+	return defaultHasher.CompareReadSeekers(a, aLength, b, bLength)
+}
+
+// CompareReadSeekers is like the package-level CompareReadSeekers,
+// using the parameters and options of the Hasher.
+func (h *Hasher) CompareReadSeekers(a io.ReadSeeker, aLength int64, b io.ReadSeeker, bLength int64) (uint32, *SpamSum, *SpamSum, error) {
+	a, b = &limitedReadSeeker{a, aLength, 0}, &limitedReadSeeker{b, bLength, 0}
+	from, err := h.HashReadSeeker(a, aLength)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	to, err := h.HashReadSeeker(b, bLength)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if comparableParts(from, to) != nil {
+		return from.Compare(*to), from, to, nil
+	}
+
+	// hash each input at the block size of the other
+	hashAt := func(source io.ReadSeeker, blocksize uint32) (*SpamSum, error) {
+		if _, err := source.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		return h.HashAtBlockSize(source, blocksize)
+	}
+	toAtFrom, err := hashAt(b, from.blocksize)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	fromAtTo, err := hashAt(a, to.blocksize)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	score := from.Compare(*toAtFrom)
+	if other := fromAtTo.Compare(*to); other > score {
+		return other, fromAtTo, to, nil
+	}
+	return score, from, toAtFrom, nil
+}
+
+// limitedReadSeeker reads the first length bytes of a ReadSeeker, like
+// an io.SectionReader for sources that are not an io.ReaderAt.
+type limitedReadSeeker struct {
+	source         io.ReadSeeker
+	length, offset int64
+}
+
+func (l *limitedReadSeeker) Read(p []byte) (int, error) {
+	if l.offset >= l.length {
+		return 0, io.EOF
+	}
+	if remaining := l.length - l.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.source.Read(p)
+	l.offset += int64(n)
+	return n, err
+}
+
+func (l *limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += l.offset
+	case io.SeekEnd:
+		offset += l.length
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek before the start of the input")
+	}
+	if _, err := l.source.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	l.offset = offset
+	return offset, nil
+}
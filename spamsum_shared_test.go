@@ -0,0 +1,84 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashAtBlockSize(t *testing.T) {
+	contents, err := os.ReadFile(filepath.Join("testdata", "LAND.MAP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := HashBytes(contents)
+	sum, err := HashAtBlockSize(bytes.NewReader(contents), uint32(expected.BlockSize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.String() != expected.String() || sum.Compare(*expected) != expected.Compare(*expected) {
+		t.Errorf("Hashing at block size %d produced %v, expected %v", expected.BlockSize(), sum, expected)
+	}
+
+	if _, err := HashAtBlockSize(bytes.NewReader(contents), minBlockSize-1); err == nil {
+		t.Error("Block sizes below the minimum should be refused")
+	}
+}
+
+func TestCompareBytes(t *testing.T) {
+	random := rand.New(rand.NewSource(41))
+	original := make([]byte, 10000)
+	random.Read(original)
+	appended := make([]byte, 200000)
+	random.Read(appended)
+	edited := append(append([]byte(nil), original...), appended...)
+
+	if score := HashBytes(original).Compare(*HashBytes(edited)); score != 0 {
+		t.Fatalf("Test inputs should not be comparable by HashBytes, scored %d", score)
+	}
+
+	score, from, to := CompareBytes(original, edited)
+	if score < 50 {
+		t.Errorf("Edited copy scored only %d", score)
+	}
+	if from.BlockSize() != to.BlockSize() || from.Compare(*to) != score {
+		t.Errorf("Returned digests %v and %v do not produce score %d", from, to, score)
+	}
+
+	// comparable inputs are hashed only once
+	score, from, to = CompareBytes(original, original[:9000])
+	if from.String() != HashBytes(original).String() || to.String() != HashBytes(original[:9000]).String() ||
+		score != from.Compare(*to) {
+		t.Errorf("Comparable inputs should use their own digests, got %v and %v", from, to)
+	}
+}
+
+func TestCompareReadSeekers(t *testing.T) {
+	first := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 100)
+	second := append(bytes.Repeat([]byte("0123456789abcdef"), 20000), first...)
+
+	expected, expectedFrom, expectedTo := CompareBytes(first, second)
+	// trailing data beyond the lengths is ignored, also when choosing
+	// the block sizes
+	trailing := bytes.Repeat([]byte("trailing data "), 50000)
+	score, from, to, err := CompareReadSeekers(
+		bytes.NewReader(append(first, trailing...)), int64(len(first)),
+		bytes.NewReader(append(second, trailing...)), int64(len(second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != expected || from.Compare(*to) != score {
+		t.Errorf("CompareReadSeekers scored %d, CompareBytes %d", score, expected)
+	}
+	if from.String() != expectedFrom.String() || to.String() != expectedTo.String() {
+		t.Errorf("CompareReadSeekers hashed %v and %v, CompareBytes %v and %v",
+			from, to, expectedFrom, expectedTo)
+	}
+}
@@ -36,6 +36,23 @@ func TestScan(t *testing.T) {
 	}
 }
 
+func TestScanKeepsCopies(t *testing.T) {
+	a := "48:wX0GLBZET14EHWFIUXs0hPbaL3RdNhI6h0:wPLBS4EecWT6hdNhs"
+	b := "49152:dihMNzhZt62oh9+onrqMPr/KwJsvD/mMplt:Hxxpj"
+
+	var sum SpamSum
+	if _, err := fmt.Sscan(a, &sum); err != nil {
+		t.Fatal(err)
+	}
+	kept := sum
+	if _, err := fmt.Sscan(b, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if kept.String() != a {
+		t.Errorf("Scanning %s into a sum changed its copy to %s", b, kept.String())
+	}
+}
+
 func TestHashReadSeeker(t *testing.T) {
 	tests := []struct {
 		filename string
@@ -115,3 +132,39 @@ func TestBlocksizeAdjustment(t *testing.T) {
 		t.Errorf("Expected %v, result was %v", expected, sum)
 	}
 }
+
+func benchmarkHashFile(b *testing.B, filename string) {
+	contents, err := os.ReadFile(filepath.Join("testdata", filename))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(contents)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		HashBytes(contents)
+	}
+}
+
+func BenchmarkHashLandMap(b *testing.B) {
+	benchmarkHashFile(b, "LAND.MAP")
+}
+
+func BenchmarkHashQuicktimeDoc(b *testing.B) {
+	benchmarkHashFile(b, "embedded_video_quicktime.doc")
+}
+
+// BenchmarkProcessBlock measures a single pass over random data,
+// without the block size estimation of HashBytes.
+func BenchmarkProcessBlock(b *testing.B) {
+	block := make([]byte, 1<<20)
+	rand.New(rand.NewSource(43)).Read(block)
+
+	writer := StartFixedBlocksize(3 << 12)
+	b.SetBytes(int64(len(block)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer.Reset()
+		writer.Write(block)
+	}
+}
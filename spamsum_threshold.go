@@ -0,0 +1,128 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"sort"
+)
+
+// CompareAtLeast compares two SpamSums like Compare, but only
+// determines the score if it is at least threshold.  If so, it
+// returns the score, which is the one Compare returns, and true.
+// Otherwise it returns 0 and false.
+//
+// Pairs of digest halves whose lengths or score cap rule out reaching
+// the threshold are skipped before the common substring test, and the
+// edit distance of the others is only computed up to the largest
+// distance that still reaches the threshold.
+func (from SpamSum) CompareAtLeast(to SpamSum, threshold uint32) (uint32, bool) {
+	if threshold == 0 {
+		return from.Compare(to), true
+	}
+
+	params := from.parameters()
+	similarity, found := 0, false
+	for _, pair := range comparableParts(&from, &to) {
+		if score, ok := scoreAtLeast(pair.from, pair.to, pair.capBlocksize, params, int(threshold)); ok {
+			similarity = max(similarity, score)
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, false
+	}
+	return uint32(similarity), true
+}
+
+// scoreAtLeast returns score(from, to, blocksize, params), and true,
+// if it is at least threshold.
+func scoreAtLeast(from, to []byte, blocksize int, params Params, threshold int) (int, bool) {
+	reducedFrom := eliminateRepetition(from)
+	reducedTo := eliminateRepetition(to)
+	fl, tl := len(reducedFrom), len(reducedTo)
+	if fl+tl == 0 || scoreCap(blocksize, fl, tl, params) < threshold {
+		return 0, false
+	}
+
+	// distanceScore decreases as the distance grows; find the
+	// first distance that scores below the threshold.
+	limit := sort.Search(fl+tl+1, func(distance int) bool {
+		return distanceScore(distance, fl, tl, params) < threshold
+	})
+	maxDistance := limit - 1
+
+	// every character without a counterpart costs at least 1
+	if maxDistance < 0 || fl-tl > maxDistance || tl-fl > maxDistance {
+		return 0, false
+	}
+
+	if !hasCommonSubstring(from, to, params.Window) {
+		return 0, false
+	}
+
+	distance, ok := boundedEditDistance(reducedFrom, reducedTo, maxDistance)
+	if !ok {
+		return 0, false
+	}
+
+	score := min(distanceScore(distance, fl, tl, params),
+		scoreCap(blocksize, fl, tl, params))
+	return score, true
+}
+
+// boundedEditDistance returns the edit distance between from and to,
+// with the costs used by editDistance, and true, if it is at most
+// limit.  Only cells within limit of the diagonal are computed, since
+// every step away from it costs at least 1, and it gives up as soon as
+// a whole row exceeds limit.
+func boundedEditDistance(from, to []byte, limit int) (int, bool) {
+	fl, tl := len(from), len(to)
+	beyond := limit + 1
+
+	previous := make([]int, tl+1)
+	current := make([]int, tl+1)
+	for j := range previous {
+		previous[j] = min(j*insCost, beyond)
+	}
+
+	for i := 1; i <= fl; i++ {
+		low, high := max(1, i-limit), min(tl, i+limit)
+
+		current[0] = min(i*delCost, beyond)
+		if low > 1 {
+			current[low-1] = beyond
+		}
+		rowMinimum := current[0]
+		if low > 1 {
+			rowMinimum = beyond
+		}
+
+		for j := low; j <= high; j++ {
+			cost := changeCost
+			if from[i-1] == to[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+delCost,
+				current[j-1]+insCost,
+				previous[j-1]+cost,
+				beyond)
+			rowMinimum = min(rowMinimum, current[j])
+		}
+		if high < tl {
+			current[high+1] = beyond
+		}
+
+		if rowMinimum > limit {
+			return 0, false
+		}
+		previous, current = current, previous
+	}
+
+	if previous[tl] > limit {
+		return 0, false
+	}
+	return previous[tl], true
+}
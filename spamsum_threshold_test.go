@@ -0,0 +1,89 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// relatedSums returns the SpamSums of count modified copies of a
+// random input, so that most pairs score somewhere between 0 and 100.
+func relatedSums(count int) []*SpamSum {
+	random := rand.New(rand.NewSource(42))
+	original := make([]byte, 20000)
+	random.Read(original)
+
+	sums := make([]*SpamSum, 0, count)
+	for i := 0; i < count; i++ {
+		input := append([]byte(nil), original...)
+		for j := random.Intn(20); j > 0; j-- {
+			start := random.Intn(len(input) - 500)
+			random.Read(input[start : start+random.Intn(500)])
+		}
+		// vary the length, and with it the block size
+		sums = append(sums, HashBytes(input[:len(input)-random.Intn(15000)]))
+	}
+	return sums
+}
+
+func TestCompareAtLeastAgreesWithCompare(t *testing.T) {
+	sums := relatedSums(30)
+	for _, from := range sums {
+		for _, to := range sums {
+			expected := from.Compare(*to)
+			for threshold := uint32(0); threshold <= 101; threshold++ {
+				score, ok := from.CompareAtLeast(*to, threshold)
+				if ok != (expected >= threshold) {
+					t.Fatalf("CompareAtLeast(%v, %v, %d) = %d, %v; Compare is %d",
+						from, to, threshold, score, ok, expected)
+				}
+				if ok && score != expected {
+					t.Fatalf("CompareAtLeast(%v, %v, %d) = %d; Compare is %d",
+						from, to, threshold, score, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestBoundedEditDistance(t *testing.T) {
+	tests := []struct{ from, to string }{
+		{"", ""},
+		{"abc", ""},
+		{"", "abcd"},
+		{"kitten", "sitting"},
+		{"abcdefghijklmnop", "abcdefgXijklmnop"},
+		{"abcdefghijklmnop", "ponmlkjihgfedcba"},
+		{"aaaabbbbcccc", "bbbbccccaaaa"},
+	}
+
+	for _, test := range tests {
+		expected := editDistance([]byte(test.from), []byte(test.to))
+		for limit := 0; limit <= expected+2; limit++ {
+			distance, ok := boundedEditDistance([]byte(test.from), []byte(test.to), limit)
+			if ok != (expected <= limit) || (ok && distance != expected) {
+				t.Errorf("boundedEditDistance(%q, %q, %d) = %d, %v; edit distance is %d",
+					test.from, test.to, limit, distance, ok, expected)
+			}
+		}
+	}
+}
+
+func BenchmarkCompare(b *testing.B) {
+	sums := relatedSums(20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sums[i%20].Compare(*sums[(i/20)%20])
+	}
+}
+
+func BenchmarkCompareAtLeast(b *testing.B) {
+	sums := relatedSums(20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sums[i%20].CompareAtLeast(*sums[(i/20)%20], 80)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"io"
+)
+
+// A ByteRange is the half-open range [Start, End) of input offsets.
+type ByteRange struct {
+	Start, End int64
+}
+
+// A Trace records, for every character of a SpamSum, the range of
+// input bytes that character is a hash of.  Left[i] belongs to the
+// i-th character of the first base64 string, Right[i] to the i-th
+// character of the second.
+type Trace struct {
+	Left, Right []ByteRange
+}
+
+// tracer fills in a Trace while processBlock runs.  offset counts
+// the bytes processed so far, leftStart and rightStart are the
+// offsets at which the current left and right blocks began.
+type tracer struct {
+	trace                         *Trace
+	offset, leftStart, rightStart int64
+}
+
+func (tr *tracer) reset() {
+	tr.trace.Left = tr.trace.Left[:0]
+	tr.trace.Right = tr.trace.Right[:0]
+	tr.offset, tr.leftStart, tr.rightStart = 0, 0, 0
+}
+
+// left records that the character at index covers the input from
+// the start of the current left block up to end bytes past offset.
+func (tr *tracer) left(index int, end int64) {
+	tr.trace.Left = setRange(tr.trace.Left, index, ByteRange{tr.leftStart, tr.offset + end})
+}
+
+func (tr *tracer) right(index int, end int64) {
+	tr.trace.Right = setRange(tr.trace.Right, index, ByteRange{tr.rightStart, tr.offset + end})
+}
+
+func setRange(ranges []ByteRange, index int, r ByteRange) []ByteRange {
+	if index < len(ranges) {
+		ranges[index] = r
+		return ranges
+	}
+	return append(ranges, r)
+}
+
+// HashBytesTraced is like HashBytes, but also returns a Trace of the
+// resulting SpamSum.
+func HashBytesTraced(b []byte) (*SpamSum, *Trace) {
+	trace := new(Trace)
+	// errors won't be produced for an in-memory byte slice
+	result, _ := defaultHasher.hashReadSeeker(bytes.NewReader(b), int64(len(b)), trace, nil)
+	return result, trace
+}
+
+// HashReadSeekerTraced is like HashReadSeeker, but also returns a
+// Trace of the resulting SpamSum.
+func HashReadSeekerTraced(source io.ReadSeeker, length int64) (*SpamSum, *Trace, error) {
+	trace := new(Trace)
+	result, err := defaultHasher.hashReadSeeker(source, length, trace, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, trace, nil
+}
+
+// A SharedRegion is a pair of byte ranges, one in each of two traced
+// inputs, whose block hashes match.  BlockSize is the block size of
+// the characters that matched.
+type SharedRegion struct {
+	BlockSize uint32
+	From, To  ByteRange
+}
+
+// tracedPart is one half of a SpamSum, along with its trace.
+type tracedPart struct {
+	digest    []byte
+	ranges    []ByteRange
+	blocksize uint32
+}
+
+func leftTraced(sum *SpamSum, trace *Trace) tracedPart {
+	digest := sum.leftPart[:nonZeroLength(sum.leftPart)]
+	return tracedPart{digest[:min(len(digest), len(trace.Left))], trace.Left, sum.blocksize}
+}
+
+func rightTraced(sum *SpamSum, trace *Trace) tracedPart {
+	digest := sum.rightPart[:nonZeroLength(sum.rightPart)]
+	return tracedPart{digest[:min(len(digest), len(trace.Right))], trace.Right, sum.blocksize * 2}
+}
+
+// SharedRegions aligns the characters of two traced SpamSums in the
+// same way Compare does, and returns the byte ranges in both inputs
+// covered by matching characters.  Runs of consecutive matching
+// characters are merged into a single region; a single matching
+// character is most likely a coincidence, and is left out.  Halves
+// that Compare would score as 0 do not contribute any regions.
+func SharedRegions(from *SpamSum, fromTrace *Trace, to *SpamSum, toTrace *Trace) []SharedRegion {
+	pairs := make([][2]tracedPart, 0, 2)
+	switch {
+	case from.parameters() != to.parameters():
+	case from.blocksize == to.blocksize:
+		pairs = append(pairs,
+			[2]tracedPart{leftTraced(from, fromTrace), leftTraced(to, toTrace)},
+			[2]tracedPart{rightTraced(from, fromTrace), rightTraced(to, toTrace)})
+	case from.blocksize == to.blocksize*2:
+		pairs = append(pairs,
+			[2]tracedPart{leftTraced(from, fromTrace), rightTraced(to, toTrace)})
+	case from.blocksize*2 == to.blocksize:
+		pairs = append(pairs,
+			[2]tracedPart{rightTraced(from, fromTrace), leftTraced(to, toTrace)})
+	}
+
+	regions := make([]SharedRegion, 0)
+	for _, pair := range pairs {
+		left, right := pair[0], pair[1]
+		if score(left.digest, right.digest, int(left.blocksize), from.parameters()) == 0 {
+			continue
+		}
+
+		run := 0
+		i, j := 0, 0
+		for _, op := range editScript(left.digest, right.digest) {
+			if op != EditMatch {
+				run = 0
+			} else if run++; run == 2 {
+				regions = append(regions, SharedRegion{
+					left.blocksize,
+					ByteRange{left.ranges[i-1].Start, left.ranges[i].End},
+					ByteRange{right.ranges[j-1].Start, right.ranges[j].End}})
+			} else if run > 2 {
+				last := &regions[len(regions)-1]
+				last.From.End = left.ranges[i].End
+				last.To.End = right.ranges[j].End
+			}
+
+			if op != EditInsert {
+				i++
+			}
+			if op != EditDelete {
+				j++
+			}
+		}
+	}
+
+	return regions
+}
@@ -0,0 +1,97 @@
+// Copyright 2013, Michiel Buddingh, All rights reserved.
+// Use of this code is governed by version 2.0 or later of the Apache
+// License, available at http://www.apache.org/licenses/LICENSE-2.0
+
+package spamsum
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func checkRanges(t *testing.T, name string, ranges []ByteRange, digestLength int, length int64) {
+	if len(ranges) != digestLength {
+		t.Errorf("%s: %d ranges traced for %d characters", name, len(ranges), digestLength)
+		return
+	}
+
+	var start int64
+	for i, r := range ranges {
+		if r.Start != start || r.End <= r.Start {
+			t.Errorf("%s: range %d is %v, should start at %d", name, i, r, start)
+		}
+		start = r.End
+	}
+	// the tail is only hashed when the rolling hash is non-zero
+	if start > length {
+		t.Errorf("%s: ranges end at %d, input is %d bytes", name, start, length)
+	}
+}
+
+func TestHashReadSeekerTraced(t *testing.T) {
+	for _, filename := range []string{"LAND.MAP", "embedded_video_quicktime.doc"} {
+		file, err := os.Open(filepath.Join("testdata", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum, trace, err := HashReadSeekerTraced(file, stat.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		untraced, _ := HashReadSeeker(file, stat.Size())
+		if sum.String() != untraced.String() {
+			t.Errorf("Tracing changed the sum of %s from %v to %v", filename, untraced, sum)
+		}
+
+		checkRanges(t, filename+" left", trace.Left, nonZeroLength(sum.leftPart[:]), stat.Size())
+		checkRanges(t, filename+" right", trace.Right, nonZeroLength(sum.rightPart[:]), stat.Size())
+	}
+}
+
+func TestSharedRegions(t *testing.T) {
+	known, err := os.ReadFile(filepath.Join("testdata", "embedded_video_quicktime.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generator := rand.New(rand.NewSource(8080))
+	surround := func(before, after int) []byte {
+		prefix, suffix := make([]byte, before), make([]byte, after)
+		generator.Read(prefix)
+		generator.Read(suffix)
+		return bytes.Join([][]byte{prefix, known, suffix}, nil)
+	}
+
+	fromOffset, toOffset := int64(3000), int64(9000)
+	fromSum, fromTrace := HashBytesTraced(surround(int(fromOffset), 5000))
+	toSum, toTrace := HashBytesTraced(surround(int(toOffset), 1000))
+
+	if fromSum.Compare(*toSum) == 0 {
+		t.Fatalf("%v and %v should be comparable", fromSum, toSum)
+	}
+
+	regions := SharedRegions(fromSum, fromTrace, toSum, toTrace)
+	if len(regions) == 0 {
+		t.Fatalf("No shared regions found between %v and %v", fromSum, toSum)
+	}
+
+	end := fromOffset + int64(len(known))
+	for _, region := range regions {
+		if region.From.End <= fromOffset || region.From.End > end {
+			t.Errorf("Region %v lies outside the shared data", region)
+		}
+		if region.From.End-fromOffset != region.To.End-toOffset {
+			t.Errorf("Region %v does not correspond to the same bytes in both inputs", region)
+		}
+	}
+}
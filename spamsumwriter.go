@@ -22,13 +22,7 @@ type SpamSumWriter struct {
 // hash blocks.  Please consider the HashBytes or HashReadSeeker
 // functions instead.
 func StartFixedBlocksize(blockSize uint32) *SpamSumWriter {
-	sum := new(SpamSumWriter)
-
-	sum.SpamSum.reset()
-	sum.spamsumState.reset()
-
-	sum.blocksize = blockSize
-	return sum
+	return defaultHasher.StartFixedBlocksize(blockSize)
 }
 
 // Reset sets the state of the SpamSumWriter to its initial value,
@@ -39,7 +33,7 @@ func (sss *SpamSumWriter) Reset() {
 }
 
 func (sss *SpamSumWriter) Size() int {
-	return SpamsumLength
+	return len(sss.leftPart)
 }
 
 // Write a byte slice to the SpamSumWriter.  Returns the length of the
@@ -51,6 +45,12 @@ func (sss *SpamSumWriter) Write(block []byte) (int, error) {
 
 func (sss *SpamSumWriter) String() (result string) {
 	writeTail(&sss.spamsumState, &sss.SpamSum)
+	if sss.options.EliminateSequences {
+		sum := sss.SpamSum.clone()
+		sum.countTail()
+		sum.eliminateSequences()
+		return sum.String()
+	}
 	result = sss.SpamSum.String()
 	return
 }
@@ -61,16 +61,20 @@ func (sss *SpamSumWriter) String() (result string) {
 // bytes.  The implementation returns a slice where the non-zero bytes
 // contain a base64-encoded 6-bit hash for a `BlockSize()`-sized
 // block.  The block hashes continue up to the end of the slice, or up
-// to the first zero byte.
+// to the first zero byte.  NewHash returns a hash.Hash whose Sum
+// encodes the complete SpamSum.
 func (sss *SpamSumWriter) Sum(block []byte) (result []byte) {
-	var cloneState spamsumState = sss.spamsumState
-	var cloneSum SpamSum = sss.SpamSum
+	var cloneState spamsumState = sss.spamsumState.clone()
+	var cloneSum SpamSum = sss.SpamSum.clone()
 
 	processBlock(block, len(block), &cloneState, &cloneSum)
 
 	writeTail(&cloneState, &cloneSum)
+	if cloneSum.options.EliminateSequences {
+		cloneSum.eliminateSequences()
+	}
 
-	result = make([]byte, SpamsumLength)
+	result = make([]byte, len(cloneSum.leftPart))
 	copy(result, cloneSum.leftPart[:cloneSum.leftIndex])
 	return
 }
@@ -136,6 +136,39 @@ func TestWriterReset(t *testing.T) {
 	}
 }
 
+func TestWriterSumDoesNotDisturb(t *testing.T) {
+	generator := rand.New(rand.NewSource(3181))
+	input := make([]byte, 8000)
+	generator.Read(input)
+
+	interrupted := StartFixedBlocksize(192)
+	interrupted.Write(input[:4000])
+	interrupted.Sum([]byte("garbagegarbage"))
+	interrupted.Write(input[4000:])
+
+	uninterrupted := StartFixedBlocksize(192)
+	uninterrupted.Write(input)
+
+	if interrupted.String() != uninterrupted.String() {
+		t.Errorf("Calling Sum changed the result from %s to %s",
+			uninterrupted.String(), interrupted.String())
+	}
+}
+
+func TestWriterResetKeepsCopies(t *testing.T) {
+	writer := StartFixedBlocksize(3)
+	writer.Write([]byte("The quick brown fox jumps over the lazy dog"))
+	expected := writer.String()
+
+	kept := writer.SpamSum
+	writer.Reset()
+	writer.Write([]byte("Pack my box with five dozen liquor jugs"))
+	if kept.String() != expected {
+		t.Errorf("Resetting the writer changed a copy of its sum from %s to %s",
+			expected, kept.String())
+	}
+}
+
 func TestSize(t *testing.T) {
 	writer := StartFixedBlocksize(16)
 	if writer.Size() != SpamsumLength {